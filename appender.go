@@ -0,0 +1,46 @@
+package mysqltsv
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// Appender is implemented by types that format themselves, like decimal types that must keep their exact scale.
+// AppendMySQLTSV appends the unescaped text of the value to dst and returns the extended buffer, or nil for NULL.
+// It takes precedence over driver.Valuer.
+type Appender interface {
+	AppendMySQLTSV(dst []byte) []byte
+}
+
+var (
+	registeredAppenders    sync.Map // map[reflect.Type]func(dst []byte, v any) []byte
+	hasRegisteredAppenders atomic.Bool
+)
+
+// RegisterAppender registers fn to format values of type T, for third-party types that can't implement Appender, like decimal.Decimal from github.com/shopspring/decimal:
+//
+//	mysqltsv.RegisterAppender(func(dst []byte, d decimal.Decimal) []byte {
+//		return append(dst, d.String()...)
+//	})
+//
+// Like Appender, fn takes precedence over driver.Valuer. It should be called during initialization, as it affects all encoders.
+func RegisterAppender[T any](fn func(dst []byte, v T) []byte) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	registeredAppenders.Store(t, func(dst []byte, v any) []byte {
+		return fn(dst, v.(T))
+	})
+	hasRegisteredAppenders.Store(true)
+}
+
+// registeredAppender returns the function registered for the type of v, if any.
+func registeredAppender(v any) (func(dst []byte, v any) []byte, bool) {
+	if !hasRegisteredAppenders.Load() {
+		return nil, false
+	}
+	fn, ok := registeredAppenders.Load(reflect.TypeOf(v))
+	if !ok {
+		return nil, false
+	}
+	return fn.(func(dst []byte, v any) []byte), true
+}
@@ -0,0 +1,166 @@
+package mysqltsv
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"time"
+)
+
+// CanonicalOptions returns EncoderOptions for exports that must be byte-identical across runs, so they can be diffed or content-addressed:
+// times are converted to UTC and the file uses DefaultOptions, with \N for NULL and LF line endings. Floats are always formatted in their shortest round-trip representation.
+// Use a SortedEncoder to also make the order of rows stable.
+func CanonicalOptions() *EncoderOptions {
+	d := DefaultOptions()
+	return &EncoderOptions{
+		Location: time.UTC,
+		Dialect:  &d,
+	}
+}
+
+// SortedEncoder buffers all rows in memory and encodes them sorted by the given key columns on Close.
+// Keys are compared by their formatted values, byte by byte, with NULL sorting first. Rows with equal keys keep their order.
+// Any errors during appending will be stored and future calls will be ignored.
+// The encoder must be Close()d to write the rows and to read any errors that might have occurred.
+type SortedEncoder struct {
+	e          *Encoder
+	numColumns int
+	keyColumns []int
+	cfg        *EncoderOptions
+	row        []any
+	rows       []sortedRow
+	err        error
+}
+
+type sortedRow struct {
+	values []any
+	key    [][]byte
+}
+
+// NewSortedEncoder starts a new sorting encoder that writes to w once it's closed.
+// Close must be called to see if any error occurred.
+// EncoderOptions is optional. ColumnOptions.Generate isn't supported.
+func NewSortedEncoder(w io.Writer, numColumns int, keyColumns []int, cfg *EncoderOptions) *SortedEncoder {
+	s := &SortedEncoder{
+		e:          NewEncoder(w, numColumns, cfg),
+		numColumns: numColumns,
+		keyColumns: keyColumns,
+		cfg:        cfg,
+		row:        make([]any, 0, numColumns),
+	}
+	for _, k := range keyColumns {
+		if k < 0 || k >= numColumns {
+			s.err = errors.New("key column out of range")
+		}
+	}
+	if cfg.hasGeneratedColumns() {
+		s.err = errGeneratedColumns
+	}
+	return s
+}
+
+func (s *SortedEncoder) AppendString(v string) {
+	s.AppendValue(v)
+}
+
+// AppendBytes buffers a copy of b.
+func (s *SortedEncoder) AppendBytes(b []byte) {
+	if b != nil {
+		b = append([]byte{}, b...)
+	}
+	s.appendValue(appendedBytes(b))
+}
+
+// appendedBytes marks values passed to AppendBytes, so they're replayed with Encoder.AppendBytes.
+type appendedBytes []byte
+
+// AppendValue buffers a value. []byte and json.RawMessage values are copied, other values must not be modified until Close.
+func (s *SortedEncoder) AppendValue(v any) {
+	switch b := v.(type) {
+	case []byte:
+		if b != nil {
+			v = append([]byte{}, b...)
+		}
+	case json.RawMessage:
+		if b != nil {
+			v = append(json.RawMessage{}, b...)
+		}
+	}
+	s.appendValue(v)
+}
+
+func (s *SortedEncoder) appendValue(v any) {
+	if s.err != nil {
+		return
+	}
+	s.row = append(s.row, v)
+	if len(s.row) < s.numColumns {
+		return
+	}
+	r := sortedRow{
+		values: s.row,
+		key:    make([][]byte, len(s.keyColumns)),
+	}
+	for i, k := range s.keyColumns {
+		c := s.cfg.column(k)
+		if b, ok := s.row[k].(appendedBytes); ok {
+			// Like Encoder.AppendBytes. applyChar doesn't get b as scratch, as padding could overwrite the buffered value.
+			if c != nil && c.NullIfZero && len(b) == 0 {
+				b = nil
+			}
+			if c != nil && c.Char != CharKeep {
+				b = c.applyChar(b, nil)
+			}
+			r.key[i] = b
+			continue
+		}
+		r.key[i], s.err = appendColumnField(make([]byte, 0, 16), nil, s.row[k], s.cfg, c)
+		if s.err != nil {
+			return
+		}
+	}
+	s.rows = append(s.rows, r)
+	s.row = make([]any, 0, s.numColumns)
+}
+
+// Close sorts and encodes all rows, and closes the underlying Encoder.
+func (s *SortedEncoder) Close() error {
+	if s.err != nil {
+		return s.err
+	}
+	if len(s.row) > 0 {
+		return errors.New("SortedEncoder closed with an incomplete row")
+	}
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		a, b := s.rows[i].key, s.rows[j].key
+		for k := range a {
+			if a[k] == nil || b[k] == nil {
+				if (a[k] == nil) != (b[k] == nil) {
+					return a[k] == nil
+				}
+				continue
+			}
+			if c := bytes.Compare(a[k], b[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	for _, r := range s.rows {
+		for _, v := range r.values {
+			if b, ok := v.(appendedBytes); ok {
+				s.e.AppendBytes(b)
+			} else {
+				s.e.AppendValue(v)
+			}
+		}
+	}
+	s.rows = nil
+	return s.e.Close()
+}
+
+func (s *SortedEncoder) Error() error {
+	return s.err
+}
@@ -0,0 +1,67 @@
+package mysqltsv
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Checksums describe the output of an Encoder, so it can be verified before it's loaded.
+type Checksums struct {
+	// Rows is the number of rows encoded.
+	Rows int64 `json:"rows"`
+	// Bytes is the number of bytes written to the underlying writer, after compression.
+	Bytes int64 `json:"bytes"`
+	// SHA256 is the hex encoded SHA-256 digest of the bytes written to the underlying writer.
+	SHA256 string `json:"sha256"`
+	// CRC32C is the hex encoded CRC-32 (Castagnoli) checksum of the bytes written to the underlying writer.
+	CRC32C string `json:"crc32c"`
+}
+
+// WriteSidecar writes the checksums as a small JSON document, to be stored next to the file they describe.
+func (c Checksums) WriteSidecar(w io.Writer) error {
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+type checksumWriter struct {
+	w   io.Writer
+	sha hash.Hash
+	crc hash.Hash32
+	n   int64
+}
+
+func newChecksumWriter(w io.Writer) *checksumWriter {
+	return &checksumWriter{
+		w:   w,
+		sha: sha256.New(),
+		crc: crc32.New(crc32cTable),
+	}
+}
+
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.sha.Write(p[:n])
+	c.crc.Write(p[:n])
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *checksumWriter) checksums(rows int64) Checksums {
+	return Checksums{
+		Rows:   rows,
+		Bytes:  c.n,
+		SHA256: hex.EncodeToString(c.sha.Sum(nil)),
+		CRC32C: fmt.Sprintf("%08x", c.crc.Sum32()),
+	}
+}
@@ -0,0 +1,179 @@
+package mysqltsv
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+	"unicode/utf8"
+)
+
+// ColumnOptions are settings for a single column. See EncoderOptions.Columns.
+type ColumnOptions struct {
+	// NullIfZero encodes the zero value of a type, like 0, "", false or the zero time.Time, as NULL. Empty slices and maps count as zero too, like with Encoder.AppendBytes.
+	NullIfZero bool
+	// Generate, if set, is called to fill this column for every row, for example with a client-side assigned key. See UUIDv7.
+	// The Encoder appends the generated value itself, so callers skip this column when appending.
+	Generate func() any
+	// Char, if set, normalizes trailing spaces of values for CHAR(CharLength) columns, whose trailing spaces MySQL strips on retrieval.
+	Char CharPadding
+	// CharLength is the length of the CHAR column in UTF-8 characters, used by CharPad.
+	CharLength int
+	// Epoch, if set, encodes time.Time values passed to AppendValue as a Unix timestamp, for legacy INT or BIGINT columns. This includes times wrapped in pointers, Nullable or sql.NullTime.
+	Epoch EpochUnit
+	// Location, if set, overrides EncoderOptions.Location for this column. For TIMESTAMP columns use time.UTC and load with the session time_zone set to '+00:00', so the server doesn't convert the values twice.
+	Location *time.Location
+}
+
+// EpochUnit is the unit of Unix timestamps. See ColumnOptions.Epoch.
+type EpochUnit int
+
+const (
+	// EpochNone encodes times as DATETIME literals.
+	EpochNone EpochUnit = iota
+	// EpochSeconds encodes times as the number of seconds since January 1, 1970 UTC.
+	EpochSeconds
+	// EpochMilliseconds encodes times as the number of milliseconds since January 1, 1970 UTC.
+	EpochMilliseconds
+)
+
+func (u EpochUnit) unix(t time.Time) int64 {
+	if u == EpochMilliseconds {
+		return t.UnixMilli()
+	}
+	return t.Unix()
+}
+
+// CharPadding is a policy for the trailing spaces of values of CHAR columns. See ColumnOptions.Char.
+type CharPadding int
+
+const (
+	// CharKeep leaves values as they are.
+	CharKeep CharPadding = iota
+	// CharTrim removes trailing spaces, so the file matches what MySQL returns for the column.
+	CharTrim
+	// CharPad pads values with spaces to ColumnOptions.CharLength characters, like MySQL does with PAD_CHAR_TO_FULL_LENGTH.
+	CharPad
+)
+
+// applyChar applies the CharPadding policy of the column to b. It might use scratch to pad the value.
+func (c *ColumnOptions) applyChar(b, scratch []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	switch c.Char {
+	case CharTrim:
+		return bytes.TrimRight(b, " ")
+	case CharPad:
+		n := c.CharLength - utf8.RuneCount(b)
+		if n <= 0 {
+			return b
+		}
+		b = append(scratch[:0], b...)
+		for ; n > 0; n-- {
+			b = append(b, ' ')
+		}
+	}
+	return b
+}
+
+// errGeneratedColumns is returned by helpers that append complete rows, which would otherwise be split up by the generated columns.
+var errGeneratedColumns = errors.New("ColumnOptions.Generate isn't supported when appending complete rows")
+
+// hasGeneratedColumns returns whether any column has a Generate function.
+func (cfg *EncoderOptions) hasGeneratedColumns() bool {
+	if cfg == nil {
+		return false
+	}
+	for _, c := range cfg.Columns {
+		if c.Generate != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// column returns the options of the column that's appended next, or nil if it has none.
+func (e *Encoder) column() *ColumnOptions {
+	return e.encoderOptions.column(e.numColumnsPerRow - e.colsLeftInRow)
+}
+
+// column returns the options of the i'th column, or nil if it has none.
+func (cfg *EncoderOptions) column(i int) *ColumnOptions {
+	if cfg != nil && i < len(cfg.Columns) {
+		return &cfg.Columns[i]
+	}
+	return nil
+}
+
+// appendColumnField appends v like Encoder.AppendValue would for a column with options c, but without escaping. A nil result means NULL.
+// Helpers that append complete rows use it to look at a value as it will be encoded. scratch is used for CharPad.
+func appendColumnField(dst, scratch []byte, v any, cfg *EncoderOptions, c *ColumnOptions) ([]byte, error) {
+	if c != nil && c.NullIfZero && isZero(v) {
+		v = nil
+	}
+	b, err := appendColumnValue(dst, v, cfg, c)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil && c.Char != CharKeep {
+		b = c.applyChar(b, scratch)
+	}
+	return b, nil
+}
+
+// generateColumns appends generated values for the upcoming columns that have a Generate function, until it reaches a column that doesn't or the row is complete.
+func (e *Encoder) generateColumns() {
+	for e.err == nil {
+		c := e.column()
+		if c == nil || c.Generate == nil {
+			return
+		}
+		b, err := appendColumnValue(e.scratch[:0], c.Generate(), e.encoderOptions, c)
+		if err != nil {
+			e.err = err
+			return
+		}
+		e.writeField(b)
+		if e.colsLeftInRow == e.numColumnsPerRow {
+			return
+		}
+	}
+}
+
+// UUIDv7 returns a new random, time ordered UUID in its canonical text form. It can be used as ColumnOptions.Generate.
+func UUIDv7() any {
+	var u [16]byte
+	if _, err := rand.Read(u[6:]); err != nil {
+		panic(err)
+	}
+	ms := uint64(time.Now().UnixMilli())
+	u[0] = byte(ms >> 40)
+	u[1] = byte(ms >> 32)
+	u[2] = byte(ms >> 24)
+	u[3] = byte(ms >> 16)
+	u[4] = byte(ms >> 8)
+	u[5] = byte(ms)
+	u[6] = 0x70 | u[6]&0x0f
+	u[8] = 0x80 | u[8]&0x3f
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// isZero returns whether v is the zero value of its type, or an empty slice or map.
+func isZero(v any) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() || rv.Kind() == reflect.Pointer && rv.IsNil() {
+		// Checked first, as a nil pointer's IsZero method might dereference it.
+		return true
+	}
+	if z, ok := v.(interface{ IsZero() bool }); ok {
+		return z.IsZero()
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return rv.Len() == 0
+	}
+	return rv.IsZero()
+}
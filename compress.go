@@ -0,0 +1,40 @@
+package mysqltsv
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// Compressor wraps the output of an Encoder in a compressed stream.
+// It's an interface so this package doesn't depend on any compression library. For example, zstd can be plugged in with:
+//
+//	mysqltsv.CompressorFunc(func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) })
+type Compressor interface {
+	// NewWriter returns a writer that compresses into w. Closing it must finish the compressed stream, but not close w.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+// CompressorFunc is an adapter to allow the use of ordinary functions as Compressor.
+type CompressorFunc func(w io.Writer) (io.WriteCloser, error)
+
+// NewWriter calls f(w).
+func (f CompressorFunc) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return f(w)
+}
+
+// Gzip is a Compressor that produces gzip streams with the default compression level.
+var Gzip Compressor = CompressorFunc(func(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+})
+
+// NewGzipEncoder starts a new Encoder that gzips its output before writing it to w.
+// Close flushes the Encoder and then finishes the gzip stream, but does not close w.
+// EncoderOptions is optional. Any Compressor set in it is ignored.
+func NewGzipEncoder(w io.Writer, numColumns int, cfg *EncoderOptions) *Encoder {
+	var opts EncoderOptions
+	if cfg != nil {
+		opts = *cfg
+	}
+	opts.Compressor = Gzip
+	return NewEncoder(w, numColumns, &opts)
+}
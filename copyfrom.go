@@ -0,0 +1,59 @@
+package mysqltsv
+
+import (
+	"io"
+)
+
+// CopyFromSource is a source of rows shaped like pgx.CopyFromSource, so row sources written for pgx.CopyFrom can be reused for MySQL.
+type CopyFromSource interface {
+	// Next advances to the next row. It returns false if there are no more rows or an error occurred.
+	Next() bool
+	// Values returns the values of the current row.
+	Values() ([]any, error)
+	// Err returns any error that has been encountered by the CopyFromSource.
+	Err() error
+}
+
+// CopyFrom encodes all rows from src into e and returns the number of rows that were encoded.
+// It does not Close e. ColumnOptions.Generate isn't supported.
+func CopyFrom(e *Encoder, src CopyFromSource) (int64, error) {
+	return FromRowReader(copyFromReader{src}, e)
+}
+
+// copyFromReader adapts a CopyFromSource to a RowReader.
+type copyFromReader struct {
+	src CopyFromSource
+}
+
+func (c copyFromReader) ReadRow() ([]any, error) {
+	if !c.src.Next() {
+		if err := c.src.Err(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return c.src.Values()
+}
+
+// CopyFromRows returns a CopyFromSource for the given rows, like pgx.CopyFromRows.
+func CopyFromRows(rows [][]any) CopyFromSource {
+	return &copyFromRows{rows: rows, idx: -1}
+}
+
+type copyFromRows struct {
+	rows [][]any
+	idx  int
+}
+
+func (c *copyFromRows) Next() bool {
+	c.idx++
+	return c.idx < len(c.rows)
+}
+
+func (c *copyFromRows) Values() ([]any, error) {
+	return c.rows[c.idx], nil
+}
+
+func (c *copyFromRows) Err() error {
+	return nil
+}
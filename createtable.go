@@ -0,0 +1,169 @@
+package mysqltsv
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// CreateTableStatement returns a CREATE TABLE statement for a table with the columns of struct type T, as returned by StructColumns.
+// This makes it easy to create staging tables with the same code that encodes into them.
+//
+// Column types are derived from the Go types: integers map to the integer type of the same size, strings to VARCHAR(255), []byte to BLOB, [N]byte to BINARY(N), time.Time to DATETIME(6), time.Duration to TIME(6) and json.RawMessage to JSON.
+// Pointers, Nullable and the sql.Null types result in nullable columns, all other columns are NOT NULL.
+// The type of a column can be overridden with a mysqltsv tag containing the complete column definition, for example `mysqltsv:"CHAR(36) NOT NULL"`.
+func CreateTableStatement[T any](table string) (string, error) {
+	t, err := structType[T]()
+	if err != nil {
+		return "", err
+	}
+	columns, err := structColumnDefinitions(t)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString("CREATE TABLE ")
+	sb.WriteString(quoteIdentifier(table))
+	sb.WriteString(" (\n")
+	for i, c := range columns {
+		if i > 0 {
+			sb.WriteString(",\n")
+		}
+		sb.WriteString("\t")
+		sb.WriteString(quoteIdentifier(c.Name))
+		sb.WriteString(" ")
+		sb.WriteString(c.Type)
+	}
+	sb.WriteString("\n)")
+	return sb.String(), nil
+}
+
+// structColumnDefinitions returns the columns of struct type t with their column definitions.
+func structColumnDefinitions(t reflect.Type) ([]ManifestColumn, error) {
+	fields := structFields(t)
+	columns := make([]ManifestColumn, len(fields))
+	for i, f := range fields {
+		sf := t.FieldByIndex(f.index)
+		def := sf.Tag.Get("mysqltsv")
+		if def == "" {
+			var err error
+			def, err = columnDefinition(sf.Type)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", sf.Name, err)
+			}
+		}
+		columns[i] = ManifestColumn{Name: f.name, Type: def}
+	}
+	return columns, nil
+}
+
+var (
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	durationType    = reflect.TypeOf(time.Duration(0))
+	nullStringType  = reflect.TypeOf(sql.NullString{})
+	nullInt64Type   = reflect.TypeOf(sql.NullInt64{})
+	nullInt32Type   = reflect.TypeOf(sql.NullInt32{})
+	nullInt16Type   = reflect.TypeOf(sql.NullInt16{})
+	nullByteType    = reflect.TypeOf(sql.NullByte{})
+	nullFloat64Type = reflect.TypeOf(sql.NullFloat64{})
+	nullBoolType    = reflect.TypeOf(sql.NullBool{})
+	nullTimeType    = reflect.TypeOf(sql.NullTime{})
+	nullableType    = reflect.TypeOf((*nullable)(nil)).Elem()
+)
+
+// columnDefinition returns the column type for values of Go type t, including its nullability.
+func columnDefinition(t reflect.Type) (string, error) {
+	null := " NOT NULL"
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		null = " NULL"
+	}
+	if t.Kind() == reflect.Struct && (t.Implements(nullableType) || isSQLNull(t)) {
+		// Both Nullable[T] and sql.Null[T] hold the value in their first field.
+		def, err := columnDefinition(t.Field(0).Type)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasSuffix(def, " NOT NULL") {
+			def = strings.TrimSuffix(def, " NOT NULL") + " NULL"
+		}
+		return def, nil
+	}
+	switch t {
+	case timeType:
+		return "DATETIME(6)" + null, nil
+	case rawMessageType:
+		return "JSON" + null, nil
+	case durationType:
+		return "TIME(6)" + null, nil
+	case nullStringType:
+		return "VARCHAR(255) NULL", nil
+	case nullInt64Type:
+		return "BIGINT NULL", nil
+	case nullInt32Type:
+		return "INT NULL", nil
+	case nullInt16Type:
+		return "SMALLINT NULL", nil
+	case nullByteType:
+		return "TINYINT UNSIGNED NULL", nil
+	case nullFloat64Type:
+		return "DOUBLE NULL", nil
+	case nullBoolType:
+		return "BOOLEAN NULL", nil
+	case nullTimeType:
+		return "DATETIME(6) NULL", nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "BOOLEAN" + null, nil
+	case reflect.Int8:
+		return "TINYINT" + null, nil
+	case reflect.Uint8:
+		return "TINYINT UNSIGNED" + null, nil
+	case reflect.Int16:
+		return "SMALLINT" + null, nil
+	case reflect.Uint16:
+		return "SMALLINT UNSIGNED" + null, nil
+	case reflect.Int32:
+		return "INT" + null, nil
+	case reflect.Uint32:
+		return "INT UNSIGNED" + null, nil
+	case reflect.Int64, reflect.Int:
+		return "BIGINT" + null, nil
+	case reflect.Uint64, reflect.Uint:
+		return "BIGINT UNSIGNED" + null, nil
+	case reflect.Float32:
+		return "FLOAT" + null, nil
+	case reflect.Float64:
+		return "DOUBLE" + null, nil
+	case reflect.String:
+		return "VARCHAR(255)" + null, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "BLOB" + null, nil
+		}
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return fmt.Sprintf("BINARY(%d)", t.Len()) + null, nil
+		}
+	}
+	return "", fmt.Errorf("no column type for %s, use a mysqltsv tag", t)
+}
+
+// quoteIdentifier quotes a MySQL identifier with backticks.
+func quoteIdentifier(s string) string {
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
+
+// ColumnList returns the parenthesized column list for a LOAD DATA statement that loads only the given columns, for example "(`id`, `name`)".
+// Clause includes it when Options.Columns is set. Omitted columns get their default value, so they must be nullable or have a default, which CheckOmittedColumns verifies.
+func ColumnList(columns []string) string {
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = quoteIdentifier(c)
+	}
+	return "(" + strings.Join(quoted, ", ") + ")"
+}
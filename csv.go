@@ -0,0 +1,90 @@
+package mysqltsv
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// CSVMapping describes how FromCSV maps CSV records to the columns of an Encoder.
+type CSVMapping struct {
+	// SkipHeader skips the first record.
+	SkipHeader bool
+	// Fields lists for each column the index of the CSV field it's read from. If nil, fields are used in order.
+	Fields []int
+	// EmptyIsNull encodes empty fields as NULL.
+	EmptyIsNull bool
+	// Convert, if set, converts the field for column col into the value that's encoded, for example with strconv.ParseFloat or time.Parse.
+	// It's not called for fields turned into NULL by EmptyIsNull.
+	Convert func(col int, field string) (any, error)
+}
+
+// FromCSV streams all records from r into e and returns the number of records that were encoded.
+// It does not Close e. ColumnOptions.Generate isn't supported.
+// CSVMapping is optional.
+func FromCSV(r *csv.Reader, e *Encoder, m *CSVMapping) (int64, error) {
+	if m == nil {
+		m = &CSVMapping{}
+	}
+	if e.encoderOptions.hasGeneratedColumns() {
+		return 0, errGeneratedColumns
+	}
+	if m.Fields != nil && len(m.Fields) != e.numColumnsPerRow {
+		return 0, fmt.Errorf("CSVMapping.Fields has %d entries, but the Encoder expects %d columns", len(m.Fields), e.numColumnsPerRow)
+	}
+	var n int64
+	values := make([]any, e.numColumnsPerRow)
+	for first := true; ; first = false {
+		record, err := r.Read()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if first && m.SkipHeader {
+			continue
+		}
+		if err := convertCSVRecord(values, record, m); err != nil {
+			line, _ := r.FieldPos(0)
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+		for _, v := range values {
+			e.AppendValue(v)
+		}
+		if err := e.Error(); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// convertCSVRecord fills values with the value for each column from record. The whole record is converted before anything is appended, so an error doesn't leave a partial row behind.
+func convertCSVRecord(values []any, record []string, m *CSVMapping) error {
+	if m.Fields == nil && len(record) != len(values) {
+		return fmt.Errorf("got %d fields, expected %d", len(record), len(values))
+	}
+	for col := range values {
+		idx := col
+		if m.Fields != nil {
+			idx = m.Fields[col]
+		}
+		if idx < 0 || idx >= len(record) {
+			return fmt.Errorf("column %d refers to field %d, but the record has %d fields", col, idx, len(record))
+		}
+		field := record[idx]
+		switch {
+		case field == "" && m.EmptyIsNull:
+			values[col] = nil
+		case m.Convert != nil:
+			v, err := m.Convert(col, field)
+			if err != nil {
+				return fmt.Errorf("column %d: %w", col, err)
+			}
+			values[col] = v
+		default:
+			values[col] = field
+		}
+	}
+	return nil
+}
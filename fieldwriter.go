@@ -0,0 +1,43 @@
+package mysqltsv
+
+// FieldWriter receives the unescaped contents of a single field. The Encoder escapes them once the field is complete.
+type FieldWriter interface {
+	Write(p []byte) (int, error)
+	WriteString(s string) (int, error)
+	WriteByte(c byte) error
+}
+
+// FieldAppender can be implemented by custom types to write themselves into a buffer owned by the Encoder, instead of producing an intermediate []byte or string.
+// Writing nothing results in an empty string, not NULL.
+type FieldAppender interface {
+	AppendFieldTo(w FieldWriter) error
+}
+
+// fieldBuffer is the FieldWriter passed to FieldAppenders. It appends to the scratch buffer of appendValue.
+type fieldBuffer struct {
+	b []byte
+}
+
+func (f *fieldBuffer) Write(p []byte) (int, error) {
+	f.b = append(f.b, p...)
+	return len(p), nil
+}
+
+func (f *fieldBuffer) WriteString(s string) (int, error) {
+	f.b = append(f.b, s...)
+	return len(s), nil
+}
+
+func (f *fieldBuffer) WriteByte(c byte) error {
+	f.b = append(f.b, c)
+	return nil
+}
+
+// appendField appends the contents written by v to dst.
+func appendField(dst []byte, v FieldAppender) ([]byte, error) {
+	f := fieldBuffer{b: dst}
+	if err := v.AppendFieldTo(&f); err != nil {
+		return nil, err
+	}
+	return f.b, nil
+}
@@ -0,0 +1,71 @@
+package mysqltsv
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FromJSONLines reads JSON objects, typically one per line, from r and encodes the given fields of each of them as a row into e.
+// It returns the number of rows that were encoded, and does not Close e.
+//
+// A column name like "user.address.city" refers to a nested field. Missing fields and JSON nulls are encoded as NULL, and nested objects and arrays are encoded as JSON text for JSON columns.
+// Numbers are encoded exactly as they appear in the input. ColumnOptions.Generate isn't supported.
+func FromJSONLines(r io.Reader, e *Encoder, columns []string) (int64, error) {
+	if e.encoderOptions.hasGeneratedColumns() {
+		return 0, errGeneratedColumns
+	}
+	paths := make([][]string, len(columns))
+	for i, c := range columns {
+		paths[i] = strings.Split(c, ".")
+	}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var n int64
+	for {
+		var obj map[string]any
+		if err := dec.Decode(&obj); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, fmt.Errorf("object %d: %w", n+1, err)
+		}
+		for i, path := range paths {
+			if err := appendJSONValue(e, lookupJSONPath(obj, path)); err != nil {
+				return n, fmt.Errorf("object %d, field %q: %w", n+1, columns[i], err)
+			}
+		}
+		if err := e.Error(); err != nil {
+			return n, fmt.Errorf("object %d: %w", n+1, err)
+		}
+		n++
+	}
+}
+
+func lookupJSONPath(obj map[string]any, path []string) any {
+	var v any = obj
+	for _, key := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+func appendJSONValue(e *Encoder, v any) error {
+	switch v := v.(type) {
+	case json.Number:
+		e.AppendString(string(v))
+	case map[string]any, []any:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		e.AppendValue(json.RawMessage(b))
+	default:
+		e.AppendValue(v)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package mysqltsv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LoadInfo holds the counters MySQL reports in the info string of the OK packet after LOAD DATA.
+// RowsAffected alone can't tell how many rows were skipped because of IGNORE or duplicate keys.
+type LoadInfo struct {
+	Records  int64
+	Deleted  int64
+	Skipped  int64
+	Warnings int64
+}
+
+// ParseLoadInfo parses an info string like "Records: 3  Deleted: 0  Skipped: 1  Warnings: 0" as returned by LOAD DATA.
+func ParseLoadInfo(info string) (LoadInfo, error) {
+	var li LoadInfo
+	fields := strings.Fields(info)
+	if len(fields)%2 != 0 {
+		return li, fmt.Errorf("can't parse LOAD DATA info %q", info)
+	}
+	seen := 0
+	for i := 0; len(fields) > i; i += 2 {
+		var dst *int64
+		switch fields[i] {
+		case "Records:":
+			dst = &li.Records
+		case "Deleted:":
+			dst = &li.Deleted
+		case "Skipped:":
+			dst = &li.Skipped
+		case "Warnings:":
+			dst = &li.Warnings
+		default:
+			return li, fmt.Errorf("can't parse LOAD DATA info %q: unknown counter %q", info, fields[i])
+		}
+		n, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil {
+			return li, fmt.Errorf("can't parse LOAD DATA info %q: %w", info, err)
+		}
+		*dst = n
+		seen++
+	}
+	if seen == 0 {
+		return li, fmt.Errorf("can't parse LOAD DATA info %q", info)
+	}
+	return li, nil
+}
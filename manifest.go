@@ -0,0 +1,66 @@
+package mysqltsv
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Manifest describes an encoded file, so a separate process can load it without out-of-band coordination.
+type Manifest struct {
+	// Dialect is the format of the file.
+	Dialect Options `json:"dialect"`
+	// Clause is the Clause of Dialect, for use in the LOAD DATA statement.
+	Clause string `json:"clause"`
+	// Columns are the columns of the file, in order. They should include ExtraColumns and the RowHash column, if used.
+	Columns []ManifestColumn `json:"columns"`
+	// Rows is the number of rows encoded.
+	Rows int64 `json:"rows"`
+	// Bytes is the number of bytes encoded, before compression.
+	Bytes int64 `json:"bytes"`
+	// Checksums is set if EncoderOptions.Checksums was set.
+	Checksums *Checksums `json:"checksums,omitempty"`
+}
+
+// ManifestColumn is a column in a Manifest.
+type ManifestColumn struct {
+	Name string `json:"name"`
+	// Type is the column definition, like the ones used by CreateTableStatement. It's optional.
+	Type string `json:"type,omitempty"`
+}
+
+// Manifest returns a Manifest for the file written by the Encoder, with the given columns. It must be called after Close.
+func (e *Encoder) Manifest(columns []ManifestColumn) Manifest {
+	m := Manifest{
+		Dialect: DefaultOptions(),
+		Columns: columns,
+		Rows:    e.rows,
+		Bytes:   e.size,
+	}
+	if e.encoderOptions != nil && e.encoderOptions.Dialect != nil {
+		m.Dialect = *e.encoderOptions.Dialect
+	}
+	m.Clause = m.Dialect.Clause()
+	if c, ok := e.Checksums(); ok {
+		m.Checksums = &c
+	}
+	return m
+}
+
+// WriteSidecar writes the manifest as a JSON document, to be stored next to the file it describes.
+func (m Manifest) WriteSidecar(w io.Writer) error {
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// StructManifestColumns returns the columns of struct type T for a Manifest, with the types CreateTableStatement would use.
+func StructManifestColumns[T any]() ([]ManifestColumn, error) {
+	t, err := structType[T]()
+	if err != nil {
+		return nil, err
+	}
+	return structColumnDefinitions(t)
+}
@@ -0,0 +1,81 @@
+package mysqltsv
+
+import (
+	"strings"
+)
+
+// multibyteLen returns a function that returns the length of the character at the start of b, for character sets whose multibyte characters can contain bytes like '\' and '"'.
+// MySQL parses such files character by character, so escaping those bytes would corrupt the character. It returns nil for other character sets.
+func multibyteLen(charset string) func(b []byte) int {
+	switch strings.ToLower(charset) {
+	case "gbk", "big5":
+		return func(b []byte) int {
+			if b[0] >= 0x81 && b[0] <= 0xFE {
+				return clampLen(2, b)
+			}
+			return 1
+		}
+	case "sjis", "cp932":
+		return func(b []byte) int {
+			if (b[0] >= 0x81 && b[0] <= 0x9F) || (b[0] >= 0xE0 && b[0] <= 0xFC) {
+				return clampLen(2, b)
+			}
+			return 1
+		}
+	case "gb18030":
+		return func(b []byte) int {
+			if b[0] < 0x81 || b[0] > 0xFE {
+				return 1
+			}
+			if len(b) > 1 && b[1] >= '0' && b[1] <= '9' {
+				return clampLen(4, b)
+			}
+			return clampLen(2, b)
+		}
+	}
+	return nil
+}
+
+func clampLen(n int, b []byte) int {
+	if n > len(b) {
+		return len(b)
+	}
+	return n
+}
+
+// escapeMultibyte is the part of escapeField that escapes data while leaving multibyte characters intact.
+func (d *dialect) escapeMultibyte(appendTo, data []byte) []byte {
+	for i := 0; len(data) > i; {
+		c := data[i]
+		if c >= 0x80 {
+			n := d.mbLen(data[i:])
+			appendTo = append(appendTo, data[i:i+n]...)
+			i += n
+			continue
+		}
+		if x := d.escapes[c]; x != 0 {
+			appendTo = append(appendTo, d.escape, x)
+		} else {
+			appendTo = append(appendTo, c)
+		}
+		i++
+	}
+	return appendTo
+}
+
+// escapesMultibyte returns the number of escapes escapeMultibyte would add to data.
+func (d *dialect) escapesMultibyte(data []byte) int {
+	var n int
+	for i := 0; len(data) > i; {
+		c := data[i]
+		if c >= 0x80 {
+			i += d.mbLen(data[i:])
+			continue
+		}
+		if d.escapes[c] != 0 {
+			n++
+		}
+		i++
+	}
+	return n
+}
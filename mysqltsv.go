@@ -5,43 +5,119 @@ package mysqltsv
 
 import (
 	"bufio"
+	"bytes"
 	"database/sql/driver"
+	"encoding"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
+	"math"
+	"math/big"
+	"net"
+	"net/netip"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // Escaping explains the escaping this package uses for inclusion in a LOAD DATA INFILE statement.
+// It's the Clause of DefaultOptions. Use the Clause of EncoderOptions.Dialect if you've set it.
 const Escaping = `CHARACTER SET binary FIELDS TERMINATED BY '\t' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '\\' LINES TERMINATED BY '\n' STARTING BY ''`
 
-/*
-type Options struct {
-	FieldsTerminatedBy       string
-	FieldsEnclosedBy         string
-	FieldsOptionallyEnclosed bool
-	FieldsEscapedBy          string
-	LinesTerminedBy          string
-	LinesStartingBy          string
+// EncoderOptions are settings that affect encoding.
+type EncoderOptions struct {
+	// Location is the timezone each time.Time will be converted to before being serialized.
+	Location *time.Location
+
+	// Dialect is the file format to produce. If nil, DefaultOptions is used. NewEncoder fails if it doesn't pass Validate.
+	Dialect *Options
+
+	// EncloseOnlyWhenNeeded skips the enclosure for fields that don't contain any special characters, which makes files with many numbers considerably smaller.
+	// It only has effect if the Dialect has FieldsOptionallyEnclosed set.
+	EncloseOnlyWhenNeeded bool
+
+	// Transcoder, if set, converts strings from UTF-8 to the character set of the file. []byte values are considered binary and are never transcoded.
+	// Set Dialect.CharacterSet to the matching MySQL character set, for example "latin1" with charmap.Windows1252.NewEncoder() from golang.org/x/text.
+	Transcoder Transcoder
+
+	// HexBinary writes []byte values as hexadecimal text, so they survive being loaded as text. Load them into a user variable and decode them in the statement, for example:
+	//	LOAD DATA ... (id, @data) SET data = UNHEX(@data)
+	// Values passed to AppendBytes are not affected.
+	HexBinary bool
+
+	// Compressor, if set, compresses the output. Close finishes the compressed stream, but doesn't close the underlying writer.
+	Compressor Compressor
+
+	// Tee, if set, receives a copy of the encoded output, for example for auditing or replaying a load.
+	// It gets the bytes before compression, so it sees exactly what LOAD DATA will read. Write errors from Tee abort encoding.
+	Tee io.Writer
+
+	// Checksums enables computing digests of the output while encoding. See Encoder.Checksums.
+	Checksums bool
+
+	// ExtraColumns are constant values appended to every row, like a load timestamp or a batch ID, so the producer doesn't have to pass them along.
+	// They're not included in the number of columns passed to NewEncoder, but must be included in the column list of the LOAD DATA statement.
+	ExtraColumns []any
+
+	// RowHash, if set, creates the hash used to add a column with a hash of every row, so later merge jobs can cheaply detect changed rows. For example sha1.New.
+	// The hex encoded hash covers the encoded fields of the row and is written after the last column, before any ExtraColumns.
+	// Like ExtraColumns, it's not included in the number of columns passed to NewEncoder.
+	RowHash func() hash.Hash
+
+	// ColumnStats enables collecting statistics about every column while encoding. See Encoder.ColumnStats.
+	ColumnStats bool
+
+	// Sample, if set, only encodes a subset of the rows. Rows that are left out don't count towards Encoder.Rows and ColumnStats.
+	Sample *SampleOptions
+
+	// FloatFormat is the format passed to strconv.AppendFloat for float32 and float64 values. If zero, 'f' is used. MySQL also reads 'e' and 'g'.
+	FloatFormat byte
+
+	// FloatPrecision is the precision passed to strconv.AppendFloat. If nil, the smallest number of digits that round-trips is used, so FLOAT and DOUBLE columns load losslessly.
+	FloatPrecision *int
+
+	// DecimalPlaces is the number of digits after the decimal point for *big.Float and *big.Rat values. For DECIMAL(M,D) columns set it to D.
+	// If nil, a *big.Float is written with the smallest number of digits that round-trips at its precision, and a *big.Rat must be an integer.
+	DecimalPlaces *int
+
+	// AllowStringer encodes values of otherwise unsupported types that implement fmt.Stringer with their String method.
+	// It's opt-in, as String is often meant for humans rather than databases.
+	AllowStringer bool
+
+	// JSONFallback encodes maps, slices, arrays and structs of otherwise unsupported types with encoding/json, for JSON columns. Nil maps and slices are encoded as NULL.
+	// Types implementing json.Marshaler are encoded with MarshalJSON, even if they'd otherwise be encoded with AllowStringer or encoding.BinaryMarshaler.
+	JSONFallback bool
+
+	// UUIDFormat is how [16]byte values and types registered with RegisterUUIDType are encoded. The default is UUIDBinary.
+	UUIDFormat UUIDFormat
+
+	// PackedIP encodes net.IP and netip.Addr values in their packed binary form, 4 bytes for IPv4 and 16 bytes for IPv6 like INET6_ATON, for VARBINARY(16) columns.
+	// Otherwise they're encoded in their text form. Networks are always encoded in their text form.
+	PackedIP bool
+
+	// NonFinite decides what happens to NaN and infinite floats, which MySQL rejects. The default is to fail with an error.
+	NonFinite NonFinitePolicy
 
-	// Character set?
+	// BoolFormat, if set, holds the literals written for bool values instead of 1 and 0, for example "true" and "false" for ENUM('true','false') columns.
+	BoolFormat *BoolFormat
+
+	// Columns holds per column settings, indexed by column number. It can be shorter than the number of columns.
+	Columns []ColumnOptions
 }
 
-func DefaultOptions() Options {
-	return Options{
-		FieldsTerminatedBy: "\t",
-		FieldsEnclosedBy:   `"`,
-		FieldsEscapedBy:    `\`,
-		LinesTerminedBy:    "\n",
-	}
+// BoolFormat are the literals written for bool values. See EncoderOptions.BoolFormat.
+type BoolFormat struct {
+	True  string
+	False string
 }
-*/
 
-// EncoderOptions are settings that affect encoding.
-type EncoderOptions struct {
-	// Location is the timezone each time.Time will be converted to before being serialized.
-	Location *time.Location
+// Transcoder converts UTF-8 text to another character set. *encoding.Encoder from golang.org/x/text/encoding implements it.
+type Transcoder interface {
+	Bytes(b []byte) ([]byte, error)
 }
 
 // Encoder encodes values into a CSV file suitable for consumption by LOAD DATA INFILE.
@@ -54,108 +130,323 @@ type Encoder struct {
 	colsLeftInRow    int
 	err              error
 	encoderOptions   *EncoderOptions
+	dialect          *dialect
+	size             int64
+	rows             int64
+	scratch          []byte
+	closer           io.Closer
+	checksums        *checksumWriter
+	extraColumns     []byte
+	rowHash          hash.Hash
+	stats            []ColumnStats
+	sampler          *sampler
+	skipRow          bool
 }
 
 // NewEncoder starts a new encoder. You should write the same number of columns per line and the Encoder will decide when a row is finished.
 // Close must be called to see if any error occurred.
 // EncoderOptions is optional.
 func NewEncoder(w io.Writer, numColumns int, cfg *EncoderOptions) *Encoder {
-	return &Encoder{
-		w:                bufio.NewWriterSize(w, 16*1024),
+	return newEncoder(w, numColumns, cfg, cfg.newSampler())
+}
+
+// newEncoder is like NewEncoder, but takes the sampler from the caller instead of EncoderOptions.Sample, so wrappers around multiple Encoders can sample all rows together.
+func newEncoder(w io.Writer, numColumns int, cfg *EncoderOptions, s *sampler) *Encoder {
+	e := &Encoder{
 		numColumnsPerRow: numColumns,
 		colsLeftInRow:    numColumns,
 		encoderOptions:   cfg,
+		dialect:          cfg.dialect(),
+		scratch:          make([]byte, 0, 64),
+		sampler:          s,
+	}
+	if cfg != nil && cfg.Dialect != nil {
+		if err := cfg.Dialect.Validate(); err != nil {
+			e.err = fmt.Errorf("invalid dialect: %w", err)
+		} else if n := len(cfg.Dialect.Columns); n != 0 && n != cfg.fieldsPerLine(numColumns) {
+			e.err = fmt.Errorf("Dialect.Columns has %d entries, but each line has %d fields", n, cfg.fieldsPerLine(numColumns))
+		}
+	}
+	if e.err == nil {
+		e.extraColumns, e.err = encodeExtraColumns(cfg, e.dialect)
+	}
+	if cfg != nil && cfg.RowHash != nil {
+		e.rowHash = cfg.RowHash()
 	}
+	if cfg != nil && cfg.ColumnStats {
+		e.stats = newColumnStats(numColumns)
+	}
+	if cfg != nil && cfg.Checksums {
+		e.checksums = newChecksumWriter(w)
+		w = e.checksums
+	}
+	if cfg != nil && cfg.Compressor != nil {
+		if cw, err := cfg.Compressor.NewWriter(w); err != nil {
+			e.err = err
+		} else {
+			w = cw
+			e.closer = cw
+		}
+	}
+	if cfg != nil && cfg.Tee != nil {
+		w = io.MultiWriter(w, cfg.Tee)
+	}
+	e.w = bufio.NewWriterSize(w, 16*1024)
+	return e
 }
 
 func (e *Encoder) writeField(b []byte) {
-	buf := e.w.AvailableBuffer()
-	_, e.err = e.w.Write(escapeField(buf, b))
+	if e.sampler != nil && e.colsLeftInRow == e.numColumnsPerRow {
+		e.skipRow = !e.sampler.keep()
+	}
+	if e.skipRow {
+		e.skipField()
+		return
+	}
+	if e.dialect.validateUTF8 && b != nil && !utf8.Valid(b) {
+		e.err = fmt.Errorf("column %d contains invalid UTF-8", e.numColumnsPerRow-e.colsLeftInRow)
+		return
+	}
+	if e.stats != nil {
+		e.stats[e.numColumnsPerRow-e.colsLeftInRow].add(b)
+	}
+	var n int
+	if e.colsLeftInRow == e.numColumnsPerRow && e.dialect.lineStart != "" {
+		n, e.err = e.w.WriteString(e.dialect.lineStart)
+		e.size += int64(n)
+		if e.err != nil {
+			return
+		}
+	}
+	buf := e.dialect.escapeField(e.w.AvailableBuffer(), b)
+	if e.rowHash != nil {
+		e.rowHash.Write(buf)
+		e.rowHash.Write([]byte(e.dialect.fieldTerm))
+	}
+	n, e.err = e.w.Write(buf)
+	e.size += int64(n)
 	if e.err != nil {
 		return
 	}
 	e.colsLeftInRow--
 	if e.colsLeftInRow == 0 {
-		e.err = e.w.WriteByte('\n')
+		if e.rowHash != nil {
+			e.writeRowHash()
+			if e.err != nil {
+				return
+			}
+		}
+		if len(e.extraColumns) > 0 {
+			n, e.err = e.w.Write(e.extraColumns)
+			e.size += int64(n)
+			if e.err != nil {
+				return
+			}
+		}
+		n, e.err = e.w.WriteString(e.dialect.lineTerm)
 		e.colsLeftInRow = e.numColumnsPerRow
+		e.rows++
 	} else {
-		e.err = e.w.WriteByte('\t')
+		n, e.err = e.w.WriteString(e.dialect.fieldTerm)
 	}
+	e.size += int64(n)
+}
+
+// writeRowHash writes the column with the hash of the row that was just completed.
+func (e *Encoder) writeRowHash() {
+	// The hex encoding is appended to scratch right after the raw sum.
+	sum := e.rowHash.Sum(e.scratch[:0])
+	e.rowHash.Reset()
+	buf := append(e.w.AvailableBuffer(), e.dialect.fieldTerm...)
+	buf = e.dialect.escapeField(buf, hexEncode(sum[len(sum):], sum))
+	n, err := e.w.Write(buf)
+	e.size += int64(n)
+	e.err = err
 }
 
 func (e *Encoder) AppendString(s string) {
-	e.AppendBytes([]byte(s))
+	e.AppendValue(s)
 }
 
 func (e *Encoder) AppendBytes(b []byte) {
-	if e.err != nil {
+	if !e.startField() {
 		return
 	}
-	e.writeField(b)
+	if c := e.column(); c != nil && c.NullIfZero && len(b) == 0 {
+		b = nil
+	}
+	e.finishField(b)
 }
 
+// AppendValue appends a value. Types implementing driver.Valuer, like sql.NullString and the other database/sql Null types, are converted with their Value method, so invalid ones are encoded as NULL.
+// sql.Null[T] and Nullable[T] are encoded as NULL or like their V.
 func (e *Encoder) AppendValue(v any) {
-	if e.err != nil {
+	if !e.startField() {
 		return
 	}
-	b, err := valueToBytes(v, e.encoderOptions)
+	c := e.column()
+	if c != nil && c.NullIfZero && isZero(v) {
+		v = nil
+	}
+	b, err := appendColumnValue(e.scratch[:0], v, e.encoderOptions, c)
 	if err != nil {
 		e.err = err
 		return
 	}
+	e.finishField(b)
+}
+
+// AppendTimeLayout appends t formatted with the given layout instead of the default format, after converting it to the Location of the column or EncoderOptions if set.
+func (e *Encoder) AppendTimeLayout(t time.Time, layout string) {
+	var loc *time.Location
+	if c := e.column(); c != nil && c.Location != nil {
+		loc = c.Location
+	} else if e.encoderOptions != nil {
+		loc = e.encoderOptions.Location
+	}
+	e.AppendTimeLayoutIn(t, layout, loc)
+}
+
+// AppendTimeLayoutIn appends t formatted with the given layout after converting it to loc. If loc is nil, t is formatted in its own location.
+func (e *Encoder) AppendTimeLayoutIn(t time.Time, layout string, loc *time.Location) {
+	if !e.startField() {
+		return
+	}
+	if c := e.column(); c != nil && c.NullIfZero && t.IsZero() {
+		e.finishField(nil)
+		return
+	}
+	if loc != nil {
+		t = t.In(loc)
+	}
+	e.finishField(t.AppendFormat(e.scratch[:0], layout))
+}
+
+// AppendDate appends the date of t, after converting it to EncoderOptions.Location if set, for DATE columns.
+func (e *Encoder) AppendDate(t time.Time) {
+	e.AppendTimeLayout(t, "2006-01-02")
+}
+
+// AppendDateTime appends t with its time of day, even at midnight, for DATETIME and TIMESTAMP columns. Fractional seconds are only included if they're not zero.
+// It's converted to EncoderOptions.Location first if set.
+func (e *Encoder) AppendDateTime(t time.Time) {
+	e.AppendTimeLayout(t, "2006-01-02 15:04:05.999999999")
+}
+
+// startField prepares for appending a field by generating the columns before it. It returns false if appending should be skipped because of an error.
+func (e *Encoder) startField() bool {
+	if e.err != nil {
+		return false
+	}
+	e.generateColumns()
+	return e.err == nil
+}
+
+// finishField writes a field and generates the columns after it, if they're in the same row.
+func (e *Encoder) finishField(b []byte) {
+	if c := e.column(); c != nil && c.Char != CharKeep {
+		b = c.applyChar(b, e.scratch)
+	}
 	e.writeField(b)
+	if e.colsLeftInRow != e.numColumnsPerRow {
+		e.generateColumns()
+	}
 }
 
 func (e *Encoder) Close() error {
-	if e.err != nil {
-		return e.err
+	err := e.err
+	if err == nil {
+		err = e.w.Flush()
 	}
-	if err := e.w.Flush(); err != nil {
-		return err
+	// The Compressor's writer is closed even after an error, as it might hold resources like goroutines.
+	if e.closer != nil {
+		if cerr := e.closer.Close(); err == nil {
+			err = cerr
+		}
+		e.closer = nil
 	}
-	return nil
+	return err
 }
 
 func (e *Encoder) Error() error {
 	return e.err
 }
 
-// Per https://dev.mysql.com/doc/refman/8.0/en/load-data.html#load-data-field-line-handling
-func escapeField(appendTo, data []byte) []byte {
-	if data == nil {
-		return []byte{'\\', 'N'}
-	}
-	if cap(appendTo) < len(data)+2 {
-		appendTo = make([]byte, 0, len(data)+5)
-	}
-	appendTo = append(appendTo, '"')
-	for _, c := range data {
-		switch c {
-		case 0:
-			appendTo = append(appendTo, '\\', '0')
-		case '\b':
-			appendTo = append(appendTo, '\\', 'b')
-		case '\n':
-			appendTo = append(appendTo, '\\', 'n')
-		case '\r':
-			appendTo = append(appendTo, '\\', 'r')
-		case '\t':
-			appendTo = append(appendTo, '\\', 't')
-		case 26:
-			appendTo = append(appendTo, '\\', 'Z')
-		case '\\':
-			appendTo = append(appendTo, '\\', '\\')
-		case '"':
-			appendTo = append(appendTo, '\\', '"')
-		default:
-			appendTo = append(appendTo, c)
-		}
-	}
-	appendTo = append(appendTo, '"')
-	return appendTo
-}
-
-func valueToBytes(v any, cfg *EncoderOptions) ([]byte, error) {
+// Checksums returns the digests of everything written to the underlying writer. It must be called after Close.
+// It returns false if EncoderOptions.Checksums wasn't set.
+func (e *Encoder) Checksums() (Checksums, bool) {
+	if e.checksums == nil {
+		return Checksums{}, false
+	}
+	return e.checksums.checksums(e.rows), true
+}
+
+// Rows returns the number of completed rows.
+func (e *Encoder) Rows() int64 {
+	return e.rows
+}
+
+// Size returns the number of bytes encoded so far, including those that are still buffered and not yet written to the underlying writer.
+// It counts bytes before compression. Use Checksums for the size of the compressed output.
+func (e *Encoder) Size() int64 {
+	return e.size
+}
+
+// fieldsPerLine returns the number of fields in each line of a file with numColumns columns, including the RowHash column and ExtraColumns.
+func (cfg *EncoderOptions) fieldsPerLine(numColumns int) int {
+	n := numColumns + len(cfg.ExtraColumns)
+	if cfg.RowHash != nil {
+		n++
+	}
+	return n
+}
+
+// encodeExtraColumns encodes EncoderOptions.ExtraColumns once, including the field terminators that precede them.
+func encodeExtraColumns(cfg *EncoderOptions, d *dialect) ([]byte, error) {
+	if cfg == nil || len(cfg.ExtraColumns) == 0 {
+		return nil, nil
+	}
+	var ret []byte
+	for i, v := range cfg.ExtraColumns {
+		b, err := appendValue(make([]byte, 0, 32), v, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("extra column %d: %w", i, err)
+		}
+		ret = append(ret, d.fieldTerm...)
+		ret = d.escapeField(ret, b)
+	}
+	return ret, nil
+}
+
+// hexEncode appends the hexadecimal encoding of src to dst.
+func hexEncode(dst, src []byte) []byte {
+	n := len(dst)
+	dst = append(dst, make([]byte, hex.EncodedLen(len(src)))...)
+	hex.Encode(dst[n:], src)
+	return dst
+}
+
+// appendValue appends the textual representation of v to dst. A nil return value means NULL.
+// dst must not be nil, as appending an empty string to a nil slice would be indistinguishable from NULL.
+func appendValue(dst []byte, v any, cfg *EncoderOptions) ([]byte, error) {
+	return appendColumnValue(dst, v, cfg, nil)
+}
+
+// appendColumnValue is like appendValue, but also applies the options of the column the value is encoded into. col can be nil.
+func appendColumnValue(dst []byte, v any, cfg *EncoderOptions, col *ColumnOptions) ([]byte, error) {
+	v, ptr := unwrapValue(v)
+	if fa, ok := v.(FieldAppender); ok {
+		return appendField(dst, fa)
+	}
+	if a, ok := v.(Appender); ok {
+		return a.AppendMySQLTSV(dst), nil
+	}
+	if fn, ok := registeredAppender(v); ok {
+		return fn(dst, v), nil
+	}
+	if u, ok := uuidBytes(v); ok {
+		return appendUUID(dst, u, cfg)
+	}
 	if dv, ok := v.(driver.Valuer); ok {
 		var err error
 		v, err = dv.Value()
@@ -165,66 +456,410 @@ func valueToBytes(v any, cfg *EncoderOptions) ([]byte, error) {
 	}
 	switch v := v.(type) {
 	case string:
-		return []byte(v), nil
+		if cfg != nil && cfg.Transcoder != nil {
+			b, err := cfg.Transcoder.Bytes(append(dst, v...))
+			if b == nil && err == nil {
+				// Don't let an empty string turn into NULL.
+				b = dst[:0]
+			}
+			return b, err
+		}
+		return append(dst, v...), nil
 	case []byte:
+		if v != nil && cfg != nil && cfg.HexBinary {
+			return hexEncode(dst, v), nil
+		}
+		if cfg != nil && cfg.Dialect != nil && isUTF8Charset(cfg.Dialect.CharacterSet) {
+			return nil, fmt.Errorf("can't encode binary value into a %s file, consider HexBinary", cfg.Dialect.CharacterSet)
+		}
 		return v, nil
 	case json.RawMessage:
 		return v, nil
 	case uint8:
-		return []byte(strconv.FormatUint(uint64(v), 10)), nil
+		return strconv.AppendUint(dst, uint64(v), 10), nil
 	case int8:
-		return []byte(strconv.FormatInt(int64(v), 10)), nil
+		return strconv.AppendInt(dst, int64(v), 10), nil
 	case uint16:
-		return []byte(strconv.FormatUint(uint64(v), 10)), nil
+		return strconv.AppendUint(dst, uint64(v), 10), nil
 	case int16:
-		return []byte(strconv.FormatInt(int64(v), 10)), nil
+		return strconv.AppendInt(dst, int64(v), 10), nil
 	case uint32:
-		return []byte(strconv.FormatUint(uint64(v), 10)), nil
+		return strconv.AppendUint(dst, uint64(v), 10), nil
 	case int32:
-		return []byte(strconv.FormatInt(int64(v), 10)), nil
+		return strconv.AppendInt(dst, int64(v), 10), nil
 	case uint64:
-		return []byte(strconv.FormatUint(v, 10)), nil
+		return strconv.AppendUint(dst, v, 10), nil
 	case int64:
-		return []byte(strconv.FormatInt(v, 10)), nil
+		return strconv.AppendInt(dst, v, 10), nil
 	case int:
-		return []byte(strconv.FormatInt(int64(v), 10)), nil
+		return strconv.AppendInt(dst, int64(v), 10), nil
 	case uint:
-		return []byte(strconv.FormatUint(uint64(v), 10)), nil
+		return strconv.AppendUint(dst, uint64(v), 10), nil
+	case net.IP:
+		if len(v) == 0 {
+			return nil, nil
+		}
+		if len(v) != net.IPv4len && len(v) != net.IPv6len {
+			return nil, fmt.Errorf("can't encode net.IP of length %d", len(v))
+		}
+		if cfg != nil && cfg.PackedIP {
+			if v4 := v.To4(); v4 != nil {
+				v = v4
+			}
+			return appendValue(dst, []byte(v), cfg)
+		}
+		return append(dst, v.String()...), nil
+	case netip.Addr:
+		if !v.IsValid() {
+			return nil, nil
+		}
+		if cfg != nil && cfg.PackedIP {
+			return appendValue(dst, v.Unmap().AsSlice(), cfg)
+		}
+		return v.AppendTo(dst), nil
+	case netip.Prefix:
+		if !v.IsValid() {
+			return nil, nil
+		}
+		return v.AppendTo(dst), nil
+	case net.IPNet:
+		return append(dst, v.String()...), nil
+	case *net.IPNet:
+		return append(dst, v.String()...), nil
+	case time.Duration:
+		return appendDuration(dst, v), nil
+	case *big.Int:
+		if v == nil {
+			return nil, nil
+		}
+		return v.Append(dst, 10), nil
+	case big.Int:
+		return v.Append(dst, 10), nil
+	case *big.Float:
+		if v == nil {
+			return nil, nil
+		}
+		if v.IsInf() {
+			return nil, fmt.Errorf("can't encode infinite *big.Float")
+		}
+		prec := -1
+		if cfg != nil && cfg.DecimalPlaces != nil {
+			prec = *cfg.DecimalPlaces
+		}
+		return v.Append(dst, 'f', prec), nil
+	case *big.Rat:
+		if v == nil {
+			return nil, nil
+		}
+		if cfg != nil && cfg.DecimalPlaces != nil {
+			return append(dst, v.FloatString(*cfg.DecimalPlaces)...), nil
+		}
+		if !v.IsInt() {
+			return nil, fmt.Errorf("can't encode *big.Rat %s without EncoderOptions.DecimalPlaces", v)
+		}
+		return v.Num().Append(dst, 10), nil
 	case nil:
 		return nil, nil
 	case bool:
+		if cfg != nil && cfg.BoolFormat != nil {
+			if v {
+				return append(dst, cfg.BoolFormat.True...), nil
+			}
+			return append(dst, cfg.BoolFormat.False...), nil
+		}
 		if v {
-			return []byte{'1'}, nil
+			return append(dst, '1'), nil
 		}
-		return []byte{'0'}, nil
+		return append(dst, '0'), nil
 	case float32:
-		return []byte(strconv.FormatFloat(float64(v), 'f', -1, 32)), nil
+		return appendFloat(dst, float64(v), 32, cfg)
 	case float64:
-		return []byte(strconv.FormatFloat(v, 'f', -1, 64)), nil
+		return appendFloat(dst, v, 64, cfg)
 	case time.Time:
-		if cfg != nil && cfg.Location != nil {
+		if col != nil && col.Epoch != EpochNone {
+			return strconv.AppendInt(dst, col.Epoch.unix(v), 10), nil
+		}
+		if col != nil && col.Location != nil {
+			v = v.In(col.Location)
+		} else if cfg != nil && cfg.Location != nil {
 			v = v.In(cfg.Location)
 		}
-		hour, min, sec := v.Clock()
-		nsec := v.Nanosecond()
-		if hour == 0 && min == 0 && sec == 0 && nsec == 0 {
-			return []byte(v.Format("2006-01-02")), nil
+		return v.AppendFormat(dst, timeLayout(v)), nil
+	default:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8 {
+			// Encode [N]byte like []byte. The copy is needed because the array inside the interface isn't addressable.
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return appendValue(dst, b, cfg)
 		}
-		if nsec == 0 {
-			return []byte(v.Format("2006-01-02 15:04:05")), nil
+		if cfg != nil && cfg.JSONFallback {
+			jm, ok := v.(json.Marshaler)
+			if !ok {
+				jm, ok = ptr.(json.Marshaler)
+			}
+			if ok {
+				b, err := jm.MarshalJSON()
+				if err != nil {
+					return nil, err
+				}
+				return append(dst, b...), nil
+			}
+		}
+		if cfg != nil && cfg.AllowStringer {
+			s, ok := v.(fmt.Stringer)
+			if !ok {
+				s, ok = ptr.(fmt.Stringer)
+			}
+			if ok {
+				return appendValue(dst, s.String(), cfg)
+			}
+		}
+		bm, ok := v.(encoding.BinaryMarshaler)
+		if !ok {
+			bm, ok = ptr.(encoding.BinaryMarshaler)
+		}
+		if ok {
+			b, err := bm.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			if b == nil {
+				b = dst[:0]
+			}
+			return appendValue(dst, b, cfg)
+		}
+		if cfg != nil && cfg.JSONFallback {
+			switch rv.Kind() {
+			case reflect.Map, reflect.Slice:
+				if rv.IsNil() {
+					return nil, nil
+				}
+				fallthrough
+			case reflect.Array, reflect.Struct:
+				b, err := json.Marshal(v)
+				if err != nil {
+					return nil, err
+				}
+				return append(dst, b...), nil
+			}
 		}
-		return []byte(v.Format("2006-01-02 15:04:05.999999999")), nil
-	default:
 		return nil, fmt.Errorf("can't encode type %T to TSV", v)
 	}
 }
 
-// EscapeValue escapes a value for use in a MySQL CSV. It's escaped as shown in the constant Escaping.
+// unwrapValue removes the Nullable and sql.Null[T] wrappers and pointers around v, so pointers to supported types are encoded like the types themselves. Nil pointers result in nil.
+// Pointers with a conversion of their own are kept. ptr is the pointer v was last dereferenced from, so the fallbacks can use methods with a pointer receiver.
+func unwrapValue(v any) (any, any) {
+	var ptr any
+	for {
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				// Typed nil pointers are NULL, even if their type has methods that would dereference them.
+				return nil, nil
+			}
+			if !isSQLNull(rv.Type().Elem()) && hasConversion(v) {
+				return v, ptr
+			}
+			ptr = v
+			v = rv.Elem().Interface()
+			continue
+		}
+		if nv, ok := v.(nullable); ok {
+			v = nv.nullableValue()
+			continue
+		}
+		if rv.Kind() == reflect.Struct && isSQLNull(rv.Type()) {
+			if !rv.FieldByName("Valid").Bool() {
+				return nil, nil
+			}
+			v = rv.FieldByName("V").Interface()
+			continue
+		}
+		return v, ptr
+	}
+}
+
+// isSQLNull returns whether t is an instance of the generic sql.Null[T].
+// Its Value method converts V with driver.DefaultParameterConverter, which turns types like time.Duration into plain integers, so it's unwrapped instead.
+func isSQLNull(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t.PkgPath() == "database/sql" && strings.HasPrefix(t.Name(), "Null[")
+}
+
+// hasConversion returns whether appendValue handles pointer v without dereferencing it.
+func hasConversion(v any) bool {
+	switch v.(type) {
+	case *big.Int, *big.Float, *big.Rat, *net.IPNet, FieldAppender, Appender, driver.Valuer:
+		return true
+	}
+	if _, ok := registeredAppender(v); ok {
+		return true
+	}
+	_, ok := uuidBytes(v)
+	return ok
+}
+
+// appendDuration appends d in the format of TIME columns, [-]HH:MM:SS with fractional seconds if they're not zero. Hours can exceed 24.
+func appendDuration(dst []byte, d time.Duration) []byte {
+	u := uint64(d)
+	if d < 0 {
+		dst = append(dst, '-')
+		u = -u
+	}
+	nsec := u % uint64(time.Second)
+	sec := u / uint64(time.Second)
+	h := sec / 3600
+	if h < 10 {
+		dst = append(dst, '0')
+	}
+	dst = strconv.AppendUint(dst, h, 10)
+	dst = append(dst, ':', byte('0'+sec/60%60/10), byte('0'+sec/60%10), ':', byte('0'+sec%60/10), byte('0'+sec%10))
+	if nsec != 0 {
+		frac := strconv.AppendUint(make([]byte, 0, 10), uint64(time.Second)+nsec, 10)
+		dst = append(dst, '.')
+		dst = append(dst, bytes.TrimRight(frac[1:], "0")...)
+	}
+	return dst
+}
+
+// NonFinitePolicy is how NaN and infinite floats are encoded. See EncoderOptions.NonFinite.
+type NonFinitePolicy int
+
+const (
+	// NonFiniteError fails encoding.
+	NonFiniteError NonFinitePolicy = iota
+	// NonFiniteNull encodes them as NULL.
+	NonFiniteNull
+	// NonFiniteClamp encodes infinities as the largest finite value of the same sign and type, and NaN as NULL.
+	NonFiniteClamp
+)
+
+// appendFloat appends v, applying the NonFinitePolicy of cfg.
+func appendFloat(dst []byte, v float64, bitSize int, cfg *EncoderOptions) ([]byte, error) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		var policy NonFinitePolicy
+		if cfg != nil {
+			policy = cfg.NonFinite
+		}
+		switch {
+		case policy == NonFiniteError:
+			return nil, fmt.Errorf("can't encode %v, MySQL doesn't support it", v)
+		case policy == NonFiniteNull || math.IsNaN(v):
+			return nil, nil
+		}
+		max := math.MaxFloat64
+		if bitSize == 32 {
+			max = math.MaxFloat32
+			// The shortest float32 representation rounds up to a value that's out of range for FLOAT.
+			bitSize = 64
+		}
+		if v < 0 {
+			max = -max
+		}
+		v = max
+	}
+	f, prec := cfg.floatFormat()
+	return strconv.AppendFloat(dst, v, f, prec, bitSize), nil
+}
+
+// floatFormat returns the format and precision for strconv.AppendFloat.
+func (cfg *EncoderOptions) floatFormat() (byte, int) {
+	if cfg == nil {
+		return 'f', -1
+	}
+	f, prec := cfg.FloatFormat, -1
+	if f == 0 {
+		f = 'f'
+	}
+	if cfg.FloatPrecision != nil {
+		prec = *cfg.FloatPrecision
+	}
+	return f, prec
+}
+
+// timeLayout picks the shortest layout that represents t without losing precision.
+func timeLayout(t time.Time) string {
+	hour, min, sec := t.Clock()
+	nsec := t.Nanosecond()
+	if hour == 0 && min == 0 && sec == 0 && nsec == 0 {
+		return "2006-01-02"
+	}
+	if nsec == 0 {
+		return "2006-01-02 15:04:05"
+	}
+	return "2006-01-02 15:04:05.999999999"
+}
+
+// EscapeValue escapes a value for use in a MySQL CSV. It's escaped as shown in the constant Escaping, or according to EncoderOptions.Dialect.
 // EncoderOptions is optional.
 func EscapeValue(v any, cfg *EncoderOptions) ([]byte, error) {
-	b, err := valueToBytes(v, cfg)
+	b, err := appendValue(make([]byte, 0, 32), v, cfg)
 	if err != nil {
 		return nil, err
 	}
-	return escapeField(nil, b), nil
+	return cfg.dialect().escapeField(nil, b), nil
+}
+
+// FormatValue formats a value as a MySQL literal, for statements like INSERT or UPDATE that are built by hand. Values are converted exactly like the Encoder does.
+// The result is NULL, a hexadecimal literal like X'c0000201' for binary values, or a quoted string literal, which MySQL converts to the type of the column. It's quoted for a server without the NO_BACKSLASH_ESCAPES sql_mode.
+// EncoderOptions is optional. Only the options that affect the formatting of values are used. The Transcoder isn't, as statements are sent in the connection's character set rather than the file's.
+func FormatValue(v any, cfg *EncoderOptions) (string, error) {
+	if cfg != nil && (cfg.Transcoder != nil || cfg.Dialect != nil) {
+		opts := *cfg
+		opts.Transcoder = nil
+		// A hexadecimal literal can hold binary values regardless of the file's character set.
+		opts.Dialect = nil
+		cfg = &opts
+	}
+	b, err := appendValue(make([]byte, 0, 32), v, cfg)
+	if err != nil {
+		return "", err
+	}
+	if b == nil {
+		return "NULL", nil
+	}
+	u, _ := unwrapValue(v)
+	_, isBytes := u.([]byte)
+	if !utf8.Valid(b) || isBytes && (cfg == nil || !cfg.HexBinary) {
+		return "X'" + hex.EncodeToString(b) + "'", nil
+	}
+	return quoteString(string(b)), nil
+}
+
+// EstimateSize returns the number of bytes the given rows would take when encoded by an Encoder with the same EncoderOptions.
+// The values are converted, but nothing is escaped or written, so this is cheaper than encoding the rows into a throwaway buffer.
+// EncoderOptions is optional. ColumnOptions are applied, except for Generate, which isn't supported. Neither is Sample, as it's random which rows would be written.
+func EstimateSize(rows [][]any, cfg *EncoderOptions) (int64, error) {
+	if cfg.hasGeneratedColumns() {
+		return 0, errGeneratedColumns
+	}
+	if cfg != nil && cfg.Sample != nil {
+		return 0, fmt.Errorf("EstimateSize doesn't support EncoderOptions.Sample")
+	}
+	var n int64
+	d := cfg.dialect()
+	extra, err := encodeExtraColumns(cfg, d)
+	if err != nil {
+		return 0, err
+	}
+	var hashLen int
+	if cfg != nil && cfg.RowHash != nil {
+		hashLen = len(d.fieldTerm) + d.escapedLen(bytes.Repeat([]byte{'0'}, hex.EncodedLen(cfg.RowHash().Size())))
+	}
+	scratch := make([]byte, 0, 64)
+	for _, row := range rows {
+		for i, v := range row {
+			b, err := appendColumnField(scratch[:0], scratch, v, cfg, cfg.column(i))
+			if err != nil {
+				return 0, err
+			}
+			n += int64(d.escapedLen(b) + len(d.fieldTerm))
+		}
+		if len(row) > 0 {
+			// The last field is followed by the line terminator instead.
+			n += int64(len(d.lineStart) + hashLen + len(extra) + len(d.lineTerm) - len(d.fieldTerm))
+		}
+	}
+	return n, nil
 }
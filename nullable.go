@@ -0,0 +1,25 @@
+package mysqltsv
+
+// Nullable is a value of type T that can be NULL, for codebases that don't want pointers or the database/sql Null types for optional fields.
+// The Encoder encodes it as NULL if Valid is false and as V otherwise.
+type Nullable[T any] struct {
+	V     T
+	Valid bool
+}
+
+// NewNullable returns a valid Nullable holding v.
+func NewNullable[T any](v T) Nullable[T] {
+	return Nullable[T]{V: v, Valid: true}
+}
+
+// nullable is implemented by every Nullable[T], so appendValue can unwrap them without knowing T.
+type nullable interface {
+	nullableValue() any
+}
+
+func (n Nullable[T]) nullableValue() any {
+	if !n.Valid {
+		return nil
+	}
+	return n.V
+}
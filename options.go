@@ -0,0 +1,383 @@
+package mysqltsv
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Options describe the format of a file, as configured by the CHARACTER SET, FIELDS and LINES clauses and the column list of LOAD DATA.
+// Use Clause to get the matching clause for the LOAD DATA statement.
+type Options struct {
+	// CharacterSet is the character set the file is interpreted as. If empty, the CHARACTER SET clause is omitted and the server uses character_set_database.
+	// For gbk, big5, sjis, cp932 and gb18030, escaping skips over multibyte characters, as their trailing bytes can look like a backslash or quote.
+	CharacterSet string `json:"character_set"`
+	// FieldsTerminatedBy separates the fields within a line.
+	FieldsTerminatedBy string `json:"fields_terminated_by"`
+	// FieldsEnclosedBy is the character fields are enclosed in. Occurrences inside a field are escaped, or doubled if there is no escape character.
+	// If empty, fields aren't enclosed and the terminators are escaped instead, which requires an escape character.
+	FieldsEnclosedBy         string `json:"fields_enclosed_by"`
+	FieldsOptionallyEnclosed bool   `json:"fields_optionally_enclosed"`
+	// FieldsEscapedBy is the escape character. If empty, nothing is escaped.
+	FieldsEscapedBy string `json:"fields_escaped_by"`
+	// LinesTerminatedBy ends every line, for example "\n" or "\r\n" for files that pass through Windows tooling.
+	LinesTerminatedBy string `json:"lines_terminated_by"`
+	// LinesStartingBy is a prefix written at the start of every line. When loading, MySQL skips everything up to and including the prefix.
+	LinesStartingBy string `json:"lines_starting_by"`
+	// NullLiteral is written for NULL values, without enclosure. MySQL reads the escape character followed by N as NULL, and the word NULL if FieldsEnclosedBy is set.
+	// Validate rejects other values, including an empty NullLiteral, unless CustomNullLiteral is set.
+	NullLiteral string `json:"null_literal"`
+	// CustomNullLiteral allows a NullLiteral that MySQL doesn't read as NULL, but as a string. It's only useful for exchanging files with other tools.
+	CustomNullLiteral bool `json:"custom_null_literal,omitempty"`
+	// Columns are the table columns the fields of each line are loaded into, including ExtraColumns and the RowHash column, if used.
+	// If empty, lines must contain every column of the table in order. Otherwise the Encoder checks that rows have this many fields, and the omitted columns get their default value.
+	// Use CheckOmittedColumns to verify that the omitted columns are nullable or have a default.
+	Columns []string `json:"columns,omitempty"`
+}
+
+// DefaultOptions returns the format this package uses by default. Its clause is the constant Escaping.
+func DefaultOptions() Options {
+	return Options{
+		CharacterSet:             "binary",
+		FieldsTerminatedBy:       "\t",
+		FieldsEnclosedBy:         `"`,
+		FieldsOptionallyEnclosed: true,
+		FieldsEscapedBy:          `\`,
+		LinesTerminatedBy:        "\n",
+		NullLiteral:              `\N`,
+	}
+}
+
+// CSVOptions returns an RFC 4180-like CSV format: fields are separated by commas and enclosed by double quotes, and double quotes inside fields are doubled.
+// There is no escape character, so NULL is written as the unquoted word NULL.
+func CSVOptions() Options {
+	return Options{
+		CharacterSet:             "binary",
+		FieldsTerminatedBy:       ",",
+		FieldsEnclosedBy:         `"`,
+		FieldsOptionallyEnclosed: true,
+		FieldsEscapedBy:          "",
+		LinesTerminatedBy:        "\n",
+		NullLiteral:              "NULL",
+	}
+}
+
+// NoBackslashEscapesOptions returns a format that can be loaded on servers running with the NO_BACKSLASH_ESCAPES sql_mode.
+// There is no escape character: fields are always enclosed, enclosure characters inside fields are doubled and NULL is written as the unquoted word NULL.
+// Use NoBackslashEscapesClause to get the matching clause.
+func NoBackslashEscapesOptions() Options {
+	return Options{
+		CharacterSet:             "binary",
+		FieldsTerminatedBy:       "\t",
+		FieldsEnclosedBy:         `"`,
+		FieldsOptionallyEnclosed: true,
+		FieldsEscapedBy:          "",
+		LinesTerminatedBy:        "\n",
+		NullLiteral:              "NULL",
+	}
+}
+
+// UTF8MB4Options returns the default format, but with the utf8mb4 character set, for loading into text columns without the binary workaround.
+// All fields must be valid UTF-8. Binary values are rejected, unless EncoderOptions.HexBinary is used.
+func UTF8MB4Options() Options {
+	o := DefaultOptions()
+	o.CharacterSet = "utf8mb4"
+	return o
+}
+
+// Clause returns the CHARACTER SET, FIELDS and LINES clauses for a LOAD DATA statement reading a file in this format, followed by the column list if Columns is set.
+func (o Options) Clause() string {
+	return o.withColumnList(o.clause(quoteString))
+}
+
+// IntoOutfileClause returns the INTO OUTFILE clause for a SELECT statement that makes the server export a file in this format.
+// Columns isn't used, as the SELECT determines the columns.
+func (o Options) IntoOutfileClause(fileName string) string {
+	return "INTO OUTFILE " + quoteString(fileName) + " " + o.clause(quoteString)
+}
+
+// NoBackslashEscapesClause is like Clause, but quotes the strings for a server running with the NO_BACKSLASH_ESCAPES sql_mode, where backslashes in string literals aren't special.
+func (o Options) NoBackslashEscapesClause() string {
+	return o.withColumnList(o.clause(quoteStringNoBackslashEscapes))
+}
+
+// withColumnList appends the column list to clause if Columns is set.
+func (o Options) withColumnList(clause string) string {
+	if len(o.Columns) == 0 {
+		return clause
+	}
+	return clause + " " + ColumnList(o.Columns)
+}
+
+func (o Options) clause(quoteString func(string) string) string {
+	var sb strings.Builder
+	if o.CharacterSet != "" {
+		sb.WriteString("CHARACTER SET ")
+		sb.WriteString(o.CharacterSet)
+		sb.WriteString(" ")
+	}
+	sb.WriteString("FIELDS TERMINATED BY ")
+	sb.WriteString(quoteString(o.FieldsTerminatedBy))
+	if o.FieldsOptionallyEnclosed && o.FieldsEnclosedBy != "" {
+		sb.WriteString(" OPTIONALLY")
+	}
+	sb.WriteString(" ENCLOSED BY ")
+	sb.WriteString(quoteString(o.FieldsEnclosedBy))
+	sb.WriteString(" ESCAPED BY ")
+	sb.WriteString(quoteString(o.FieldsEscapedBy))
+	sb.WriteString(" LINES TERMINATED BY ")
+	sb.WriteString(quoteString(o.LinesTerminatedBy))
+	sb.WriteString(" STARTING BY ")
+	sb.WriteString(quoteString(o.LinesStartingBy))
+	return sb.String()
+}
+
+// Validate returns an error if the options describe a format that can't be loaded reliably.
+func (o Options) Validate() error {
+	if o.FieldsTerminatedBy == "" {
+		return errors.New("FieldsTerminatedBy must not be empty")
+	}
+	if o.LinesTerminatedBy == "" {
+		return errors.New("LinesTerminatedBy must not be empty")
+	}
+	if len(o.FieldsEnclosedBy) > 1 {
+		return fmt.Errorf("FieldsEnclosedBy must be a single character, got %q", o.FieldsEnclosedBy)
+	}
+	if len(o.FieldsEscapedBy) > 1 {
+		return fmt.Errorf("FieldsEscapedBy must be a single character, got %q", o.FieldsEscapedBy)
+	}
+	if o.FieldsEnclosedBy == "" && o.FieldsEscapedBy == "" {
+		return errors.New("FieldsEnclosedBy and FieldsEscapedBy can't both be empty, as terminators inside fields couldn't be represented")
+	}
+	if o.FieldsEnclosedBy != "" && o.FieldsEnclosedBy == o.FieldsEscapedBy {
+		return fmt.Errorf("FieldsEnclosedBy and FieldsEscapedBy are both %q", o.FieldsEnclosedBy)
+	}
+	for _, c := range []struct{ name, value string }{{"FieldsEnclosedBy", o.FieldsEnclosedBy}, {"FieldsEscapedBy", o.FieldsEscapedBy}} {
+		if c.value == "" {
+			continue
+		}
+		if strings.HasPrefix(o.FieldsTerminatedBy, c.value) {
+			return fmt.Errorf("%s %q conflicts with FieldsTerminatedBy %q", c.name, c.value, o.FieldsTerminatedBy)
+		}
+		if strings.HasPrefix(o.LinesTerminatedBy, c.value) {
+			return fmt.Errorf("%s %q conflicts with LinesTerminatedBy %q", c.name, c.value, o.LinesTerminatedBy)
+		}
+	}
+	if strings.Contains(o.NullLiteral, o.FieldsTerminatedBy) || strings.Contains(o.NullLiteral, o.LinesTerminatedBy) {
+		return fmt.Errorf("NullLiteral %q contains a terminator", o.NullLiteral)
+	}
+	if !o.CustomNullLiteral && !o.loadsAsNull() {
+		return fmt.Errorf("MySQL doesn't read NullLiteral %q as NULL with this format, set CustomNullLiteral if that's intended", o.NullLiteral)
+	}
+	seen := make(map[string]bool, len(o.Columns))
+	for _, c := range o.Columns {
+		// Column names are case insensitive.
+		k := strings.ToLower(c)
+		if seen[k] {
+			return fmt.Errorf("column %q is listed twice in Columns", c)
+		}
+		seen[k] = true
+	}
+	return nil
+}
+
+// loadsAsNull returns whether LOAD DATA reads NullLiteral as NULL.
+func (o Options) loadsAsNull() bool {
+	if o.FieldsEscapedBy != "" && o.NullLiteral == o.FieldsEscapedBy+"N" {
+		return true
+	}
+	return o.FieldsEnclosedBy != "" && o.NullLiteral == "NULL"
+}
+
+// quoteString quotes s as a MySQL string literal.
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('\'')
+	for i := 0; len(s) > i; i++ {
+		switch c := s[i]; c {
+		case 0:
+			sb.WriteString(`\0`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case 26:
+			sb.WriteString(`\Z`)
+		case '\\', '\'':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
+
+func isUTF8Charset(charset string) bool {
+	switch strings.ToLower(charset) {
+	case "utf8mb4", "utf8", "utf8mb3":
+		return true
+	}
+	return false
+}
+
+// quoteStringNoBackslashEscapes quotes s as a MySQL string literal for the NO_BACKSLASH_ESCAPES sql_mode.
+func quoteStringNoBackslashEscapes(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// dialect is the precomputed form of Options used while encoding.
+type dialect struct {
+	fieldTerm  string
+	lineTerm   string
+	lineStart  string
+	enclose    byte
+	hasEnclose bool
+	// escape is written before every character that needs escaping. It's the escape character, or the enclosure character if there is no escape character and enclosures are doubled.
+	escape byte
+	// escapes[c] is the byte written after escape to represent c, or 0 if c can be written as is.
+	escapes [256]byte
+	null    []byte
+	// minimal is set if fields are only enclosed if they contain one of the bytes in needsEnclosure.
+	minimal        bool
+	needsEnclosure [256]bool
+	// mbLen is set for character sets where escaping must skip over multibyte characters. See multibyteLen.
+	mbLen func(b []byte) int
+	// validateUTF8 is set for the utf8 character sets, to reject fields that would be mangled while loading.
+	validateUTF8 bool
+}
+
+var defaultDialect = newDialect(DefaultOptions())
+
+func newDialect(o Options) *dialect {
+	d := &dialect{
+		fieldTerm:    o.FieldsTerminatedBy,
+		lineTerm:     o.LinesTerminatedBy,
+		lineStart:    o.LinesStartingBy,
+		null:         []byte(o.NullLiteral),
+		mbLen:        multibyteLen(o.CharacterSet),
+		validateUTF8: isUTF8Charset(o.CharacterSet),
+	}
+	if o.FieldsEnclosedBy != "" {
+		d.enclose = o.FieldsEnclosedBy[0]
+		d.hasEnclose = true
+	}
+	if o.FieldsEscapedBy != "" {
+		// Per https://dev.mysql.com/doc/refman/8.0/en/load-data.html#load-data-field-line-handling
+		d.escape = o.FieldsEscapedBy[0]
+		d.escapes[0] = '0'
+		d.escapes['\b'] = 'b'
+		d.escapes['\n'] = 'n'
+		d.escapes['\r'] = 'r'
+		d.escapes['\t'] = 't'
+		d.escapes[26] = 'Z'
+		d.escapes[d.escape] = d.escape
+		if d.hasEnclose {
+			d.escapes[d.enclose] = d.enclose
+		} else {
+			// Without enclosure, the terminators must be escaped too. MySQL takes the character after the escape character literally.
+			for _, term := range []string{d.fieldTerm, d.lineTerm} {
+				if term != "" && d.escapes[term[0]] == 0 {
+					d.escapes[term[0]] = term[0]
+				}
+			}
+		}
+	} else {
+		if d.hasEnclose {
+			d.escape = d.enclose
+			d.escapes[d.enclose] = d.enclose
+		}
+	}
+	return d
+}
+
+func (cfg *EncoderOptions) dialect() *dialect {
+	if cfg == nil || (cfg.Dialect == nil && !cfg.EncloseOnlyWhenNeeded) {
+		return defaultDialect
+	}
+	o := DefaultOptions()
+	if cfg.Dialect != nil {
+		o = *cfg.Dialect
+	}
+	d := newDialect(o)
+	if cfg.EncloseOnlyWhenNeeded && o.FieldsOptionallyEnclosed && d.hasEnclose {
+		d.minimal = true
+		for c := range d.escapes {
+			d.needsEnclosure[c] = d.escapes[c] != 0
+		}
+		for _, term := range []string{d.fieldTerm, d.lineTerm} {
+			if term != "" {
+				d.needsEnclosure[term[0]] = true
+			}
+		}
+	}
+	return d
+}
+
+// encloses returns whether data should be enclosed.
+func (d *dialect) encloses(data []byte) bool {
+	if !d.hasEnclose {
+		return false
+	}
+	if !d.minimal {
+		return true
+	}
+	// An unenclosed NULL is read as NULL rather than as a string, and the NullLiteral must stay recognizable.
+	if string(data) == "NULL" || string(data) == string(d.null) {
+		return true
+	}
+	for _, c := range data {
+		if d.needsEnclosure[c] {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *dialect) escapeField(appendTo, data []byte) []byte {
+	if data == nil {
+		return append(appendTo, d.null...)
+	}
+	enclose := d.encloses(data)
+	if enclose {
+		appendTo = append(appendTo, d.enclose)
+	}
+	if d.mbLen != nil {
+		appendTo = d.escapeMultibyte(appendTo, data)
+	} else {
+		for _, c := range data {
+			if x := d.escapes[c]; x != 0 {
+				appendTo = append(appendTo, d.escape, x)
+			} else {
+				appendTo = append(appendTo, c)
+			}
+		}
+	}
+	if enclose {
+		appendTo = append(appendTo, d.enclose)
+	}
+	return appendTo
+}
+
+// escapedLen returns the length escapeField would produce for data.
+func (d *dialect) escapedLen(data []byte) int {
+	if data == nil {
+		return len(d.null)
+	}
+	n := len(data)
+	if d.encloses(data) {
+		n += 2
+	}
+	if d.mbLen != nil {
+		return n + d.escapesMultibyte(data)
+	}
+	for _, c := range data {
+		if d.escapes[c] != 0 {
+			n++
+		}
+	}
+	return n
+}
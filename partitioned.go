@@ -0,0 +1,134 @@
+package mysqltsv
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// OpenPartitionFunc is called by a PartitionedEncoder the first time it encounters a partition key.
+// key is the key column's value as it would be encoded, before escaping. null is true if the key column was NULL.
+type OpenPartitionFunc func(key string, null bool) (io.WriteCloser, error)
+
+// PartitionedEncoder writes rows to a separate output per distinct value of a key column, for example one file per day.
+// Outputs are created on demand by the OpenPartitionFunc, which makes it easy to feed LOAD DATA ... PARTITION statements.
+// Any errors during appending will be stored and future calls will be ignored.
+// The PartitionedEncoder must be Close()d once done to flush and close all outputs and to read any errors that might have occurred.
+type PartitionedEncoder struct {
+	open       OpenPartitionFunc
+	numColumns int
+	keyColumn  int
+	cfg        *EncoderOptions
+	sampler    *sampler
+	partitions map[string]*partition
+	null       *partition
+	scratch    []byte
+	err        error
+}
+
+type partition struct {
+	e *Encoder
+	w io.WriteCloser
+}
+
+// NewPartitionedEncoder creates a PartitionedEncoder. keyColumn is the zero-based index of the column whose value selects the output.
+// Close must be called to see if any error occurred.
+// EncoderOptions is optional. ColumnOptions.Generate isn't supported.
+func NewPartitionedEncoder(numColumns, keyColumn int, open OpenPartitionFunc, cfg *EncoderOptions) *PartitionedEncoder {
+	p := &PartitionedEncoder{
+		open:       open,
+		numColumns: numColumns,
+		keyColumn:  keyColumn,
+		cfg:        cfg,
+		sampler:    cfg.newSampler(),
+		partitions: map[string]*partition{},
+		scratch:    make([]byte, 0, 64),
+	}
+	if cfg.hasGeneratedColumns() {
+		p.err = errGeneratedColumns
+	} else if keyColumn < 0 || keyColumn >= numColumns {
+		p.err = fmt.Errorf("key column %d is out of range for %d columns", keyColumn, numColumns)
+	}
+	return p
+}
+
+// AppendRow appends a complete row to the output belonging to its key column, creating that output if needed.
+func (p *PartitionedEncoder) AppendRow(row []any) {
+	if p.err != nil {
+		return
+	}
+	if len(row) != p.numColumns {
+		p.err = fmt.Errorf("got a row with %d columns, expected %d", len(row), p.numColumns)
+		return
+	}
+	// Rows are sampled before they're routed, so the sample is taken over all rows and no partitions are opened for rows that are left out.
+	if p.sampler != nil && !p.sampler.keep() {
+		return
+	}
+	b, err := appendColumnField(p.scratch[:0], p.scratch, row[p.keyColumn], p.cfg, p.cfg.column(p.keyColumn))
+	if err != nil {
+		p.err = err
+		return
+	}
+	var part *partition
+	if b == nil {
+		part = p.null
+	} else {
+		part = p.partitions[string(b)]
+	}
+	if part == nil {
+		w, err := p.open(string(b), b == nil)
+		if err != nil {
+			p.err = err
+			return
+		}
+		part = &partition{e: newEncoder(w, p.numColumns, p.cfg, nil), w: w}
+		if b == nil {
+			p.null = part
+		} else {
+			p.partitions[string(b)] = part
+		}
+	}
+	for _, v := range row {
+		part.e.AppendValue(v)
+	}
+	p.err = part.e.Error()
+}
+
+// Keys returns the sorted keys of all non-NULL partitions that have been opened so far.
+func (p *PartitionedEncoder) Keys() []string {
+	keys := make([]string, 0, len(p.partitions))
+	for k := range p.partitions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Close flushes and closes all outputs and returns the first error that occurred.
+func (p *PartitionedEncoder) Close() error {
+	err := p.err
+	for _, part := range p.partitions {
+		if cerr := part.close(); err == nil {
+			err = cerr
+		}
+	}
+	if p.null != nil {
+		if cerr := p.null.close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (p *partition) close() error {
+	err := p.e.Close()
+	if cerr := p.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (p *PartitionedEncoder) Error() error {
+	return p.err
+}
@@ -0,0 +1,213 @@
+package mysqltsv
+
+import (
+	"io"
+)
+
+// OpenChunkFunc is called by a RotatingEncoder to create the output for chunk n, counting from 0.
+// It's responsible for naming the chunk, for example by creating a file called fmt.Sprintf("export-%05d.tsv", n).
+type OpenChunkFunc func(n int) (io.WriteCloser, error)
+
+// ChunkSink receives the chunks produced by a RotatingEncoder, for example by uploading them to an object store like S3 or GCS.
+type ChunkSink interface {
+	// Open creates the output for a new chunk. Closing the writer must finish the upload.
+	Open(name string) (io.WriteCloser, error)
+	// Complete is called after a chunk's writer was closed successfully.
+	Complete(info ChunkInfo) error
+}
+
+// ChunkInfo describes a completed chunk.
+type ChunkInfo struct {
+	// Name is the name the chunk was opened with.
+	Name string
+	// Index is the number of the chunk, counting from 0.
+	Index int
+	// Rows is the number of rows in the chunk.
+	Rows int64
+	// Bytes is the encoded size of the chunk, before any compression.
+	Bytes int64
+	// Checksums are the digests of the chunk. It's only set if EncoderOptions.Checksums is enabled.
+	Checksums *Checksums
+}
+
+// RotateOptions decide when a RotatingEncoder moves on to the next chunk.
+// A zero value disables that limit. Chunks are only ever split between rows, so a chunk can exceed MaxBytes by at most one row.
+type RotateOptions struct {
+	// MaxRows is the maximum number of rows per chunk.
+	MaxRows int64
+	// MaxBytes is the number of bytes after which a new chunk is started.
+	// It's compared to Encoder.Size, which counts bytes before compression. With a Compressor the chunks are smaller than MaxBytes, by the compression ratio of the data.
+	MaxBytes int64
+	// MaxBinlogBytes bounds the estimated size of the binary log a LOAD DATA of a single chunk generates with binlog_format=ROW, so one statement doesn't stall replicas or overflow binlog_cache_size.
+	// See EstimateBinlogSize for how it's estimated.
+	MaxBinlogBytes int64
+	// BinlogRowOverhead is the estimated number of bytes every row adds to the binary log on top of its data. If zero, DefaultBinlogRowOverhead is used.
+	// Tables with many columns or nullable columns have a larger overhead.
+	BinlogRowOverhead int64
+}
+
+// DefaultBinlogRowOverhead is the BinlogRowOverhead used if none is set.
+const DefaultBinlogRowOverhead = 16
+
+// EstimateBinlogSize estimates the size of the binary log events for loading rows with the given total encoded size in ROW format with binlog_row_image=FULL.
+// Row images store values in binary, which is usually smaller than the text encoding, but every row has a header and the events have their own headers.
+// The estimate is rough and errs on the large side.
+func EstimateBinlogSize(rows, encodedBytes, rowOverhead int64) int64 {
+	// Write_rows events are split at binlog_row_event_max_size, 8 KiB by default, and each has about 64 bytes of headers.
+	events := encodedBytes/8192 + 1
+	return encodedBytes + rows*rowOverhead + events*64
+}
+
+// RotatingEncoder encodes rows into a sequence of outputs, closing the current one and opening the next once it grew too big.
+// Each chunk is a complete file that can be loaded on its own, possibly in parallel with the others.
+// Any errors during appending will be stored and future calls will be ignored.
+// The RotatingEncoder must be Close()d once done to flush and close the last chunk and to read any errors that might have occurred.
+type RotatingEncoder struct {
+	open       OpenChunkFunc
+	sink       ChunkSink
+	name       func(n int) string
+	numColumns int
+	rot        RotateOptions
+	cfg        *EncoderOptions
+	sampler    *sampler
+	e          *Encoder
+	w          io.WriteCloser
+	chunks     int
+	err        error
+}
+
+// NewRotatingEncoder creates a RotatingEncoder. The first chunk is opened once the first value is appended, so no empty chunks are created.
+// Close must be called to see if any error occurred.
+// EncoderOptions is optional.
+func NewRotatingEncoder(numColumns int, open OpenChunkFunc, rot RotateOptions, cfg *EncoderOptions) *RotatingEncoder {
+	return &RotatingEncoder{
+		open:       open,
+		numColumns: numColumns,
+		rot:        rot,
+		cfg:        cfg,
+		sampler:    cfg.newSampler(),
+	}
+}
+
+// NewChunkSinkEncoder creates a RotatingEncoder that writes its chunks to sink. name is called to name chunk n, counting from 0.
+// The sink is told about every chunk once it's been closed, including the last one during Close.
+// Close must be called to see if any error occurred.
+// EncoderOptions is optional.
+func NewChunkSinkEncoder(numColumns int, sink ChunkSink, name func(n int) string, rot RotateOptions, cfg *EncoderOptions) *RotatingEncoder {
+	r := NewRotatingEncoder(numColumns, func(n int) (io.WriteCloser, error) {
+		return sink.Open(name(n))
+	}, rot, cfg)
+	r.sink = sink
+	r.name = name
+	return r
+}
+
+// next returns the Encoder to append to, rotating if we're at the start of a row and the current chunk is full.
+func (r *RotatingEncoder) next() *Encoder {
+	if r.err != nil {
+		return nil
+	}
+	if r.e != nil && r.e.colsLeftInRow == r.numColumns && r.full() {
+		r.err = r.closeChunk()
+		if r.err != nil {
+			return nil
+		}
+	}
+	if r.e == nil {
+		w, err := r.open(r.chunks)
+		if err != nil {
+			r.err = err
+			return nil
+		}
+		r.w = w
+		// The chunks share the sampler, so the sample is taken over all rows rather than per chunk.
+		r.e = newEncoder(w, r.numColumns, r.cfg, r.sampler)
+		r.chunks++
+	}
+	return r.e
+}
+
+func (r *RotatingEncoder) full() bool {
+	if r.rot.MaxRows > 0 && r.e.Rows() >= r.rot.MaxRows {
+		return true
+	}
+	if r.rot.MaxBytes > 0 && r.e.Size() >= r.rot.MaxBytes {
+		return true
+	}
+	if r.rot.MaxBinlogBytes > 0 {
+		overhead := r.rot.BinlogRowOverhead
+		if overhead == 0 {
+			overhead = DefaultBinlogRowOverhead
+		}
+		if EstimateBinlogSize(r.e.Rows(), r.e.Size(), overhead) >= r.rot.MaxBinlogBytes {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RotatingEncoder) closeChunk() error {
+	e := r.e
+	err := e.Close()
+	if cerr := r.w.Close(); err == nil {
+		err = cerr
+	}
+	r.e = nil
+	r.w = nil
+	if err == nil && r.sink != nil {
+		n := r.chunks - 1
+		info := ChunkInfo{
+			Name:  r.name(n),
+			Index: n,
+			Rows:  e.Rows(),
+			Bytes: e.Size(),
+		}
+		if c, ok := e.Checksums(); ok {
+			info.Checksums = &c
+		}
+		err = r.sink.Complete(info)
+	}
+	return err
+}
+
+func (r *RotatingEncoder) AppendString(s string) {
+	if e := r.next(); e != nil {
+		e.AppendString(s)
+		r.err = e.Error()
+	}
+}
+
+func (r *RotatingEncoder) AppendBytes(b []byte) {
+	if e := r.next(); e != nil {
+		e.AppendBytes(b)
+		r.err = e.Error()
+	}
+}
+
+func (r *RotatingEncoder) AppendValue(v any) {
+	if e := r.next(); e != nil {
+		e.AppendValue(v)
+		r.err = e.Error()
+	}
+}
+
+// Chunks returns the number of chunks that have been opened so far.
+func (r *RotatingEncoder) Chunks() int {
+	return r.chunks
+}
+
+// Close flushes and closes the current chunk.
+func (r *RotatingEncoder) Close() error {
+	if r.e == nil {
+		return r.err
+	}
+	err := r.closeChunk()
+	if r.err != nil {
+		return r.err
+	}
+	return err
+}
+
+func (r *RotatingEncoder) Error() error {
+	return r.err
+}
@@ -0,0 +1,41 @@
+package mysqltsv
+
+import (
+	"fmt"
+	"io"
+)
+
+// RowReader is a source of rows, for example a thin wrapper around a Parquet reader. It lets FromRowReader feed other file formats into an Encoder without this package depending on their libraries.
+type RowReader interface {
+	// ReadRow returns the next row, or io.EOF once there are no more rows. The values must be supported by Encoder.AppendValue.
+	// The returned slice is not retained, so it can be reused between calls.
+	ReadRow() ([]any, error)
+}
+
+// FromRowReader streams all rows from r into e and returns the number of rows that were encoded.
+// It does not Close e. ColumnOptions.Generate isn't supported.
+func FromRowReader(r RowReader, e *Encoder) (int64, error) {
+	if e.encoderOptions.hasGeneratedColumns() {
+		return 0, errGeneratedColumns
+	}
+	var n int64
+	for {
+		row, err := r.ReadRow()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if len(row) != e.numColumnsPerRow {
+			return n, fmt.Errorf("row %d has %d columns, expected %d", n+1, len(row), e.numColumnsPerRow)
+		}
+		for _, v := range row {
+			e.AppendValue(v)
+		}
+		if err := e.Error(); err != nil {
+			return n, fmt.Errorf("row %d: %w", n+1, err)
+		}
+		n++
+	}
+}
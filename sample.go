@@ -0,0 +1,54 @@
+package mysqltsv
+
+import (
+	"math/rand"
+)
+
+// SampleOptions select a subset of the rows to encode, for example to create a representative test dataset from production sized inputs.
+type SampleOptions struct {
+	// Every keeps one out of every Every rows, starting with the first.
+	Every int64
+	// Fraction keeps every row with this probability, between 0 and 1.
+	Fraction float64
+	// Seed seeds the pseudo-random generator used for Fraction, so the same input results in the same sample.
+	Seed int64
+}
+
+type sampler struct {
+	opts SampleOptions
+	rng  *rand.Rand
+	n    int64
+}
+
+// newSampler returns a sampler for EncoderOptions.Sample, or nil if it's not set.
+func (cfg *EncoderOptions) newSampler() *sampler {
+	if cfg == nil || cfg.Sample == nil {
+		return nil
+	}
+	return &sampler{
+		opts: *cfg.Sample,
+		rng:  rand.New(rand.NewSource(cfg.Sample.Seed)),
+	}
+}
+
+// keep decides whether the next row is encoded.
+func (s *sampler) keep() bool {
+	n := s.n
+	s.n++
+	if s.opts.Every > 1 && n%s.opts.Every != 0 {
+		return false
+	}
+	if s.opts.Fraction > 0 && s.rng.Float64() >= s.opts.Fraction {
+		return false
+	}
+	return true
+}
+
+// skipField consumes a field of a row that isn't part of the sample.
+func (e *Encoder) skipField() {
+	e.colsLeftInRow--
+	if e.colsLeftInRow == 0 {
+		e.colsLeftInRow = e.numColumnsPerRow
+		e.skipRow = false
+	}
+}
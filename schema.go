@@ -0,0 +1,52 @@
+package mysqltsv
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CheckOmittedColumns returns an error if table, in the current database, doesn't have all of the given columns, or if any of its other columns is NOT NULL without a default.
+// LOAD DATA would give such columns their implicit default, like 0 or the empty string, or fail in strict mode. Use it with Options.Columns before loading a subset of the columns.
+func CheckOmittedColumns(ctx context.Context, q RowQueryer, table string, columns []string) error {
+	var doc sql.NullString
+	const query = "SELECT JSON_OBJECTAGG(COLUMN_NAME, IS_NULLABLE = 'YES' OR COLUMN_DEFAULT IS NOT NULL OR EXTRA LIKE '%auto_increment%' OR EXTRA LIKE '%GENERATED%') FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?"
+	if err := q.QueryRowContext(ctx, query, table).Scan(&doc); err != nil {
+		return err
+	}
+	if !doc.Valid {
+		return fmt.Errorf("table %s doesn't exist", quoteIdentifier(table))
+	}
+	var hasDefault map[string]int
+	if err := json.Unmarshal([]byte(doc.String), &hasDefault); err != nil {
+		return err
+	}
+	// Column names are case insensitive.
+	loaded := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		loaded[strings.ToLower(c)] = true
+	}
+	var missing []string
+	for name, ok := range hasDefault {
+		if loaded[strings.ToLower(name)] {
+			delete(loaded, strings.ToLower(name))
+			continue
+		}
+		if ok == 0 {
+			missing = append(missing, quoteIdentifier(name))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("omitted columns of %s are NOT NULL without a default: %s", quoteIdentifier(table), strings.Join(missing, ", "))
+	}
+	for _, c := range columns {
+		if loaded[strings.ToLower(c)] {
+			return fmt.Errorf("table %s has no column %s", quoteIdentifier(table), quoteIdentifier(c))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package mysqltsv
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+)
+
+// ShardedEncoder distributes rows over multiple Encoders based on the hash of a key column.
+// Each writer receives a complete file of its own, so the shards can be loaded with parallel LOAD DATA statements.
+// Rows with the same key always end up in the same shard. NULL keys all go to the first shard.
+// Any errors during appending will be stored and future calls will be ignored.
+// The ShardedEncoder must be Close()d once done to flush all shards and to read any errors that might have occurred.
+type ShardedEncoder struct {
+	encoders   []*Encoder
+	numColumns int
+	keyColumn  int
+	cfg        *EncoderOptions
+	sampler    *sampler
+	scratch    []byte
+	err        error
+}
+
+// NewShardedEncoder starts a new Encoder for each of the given writers. keyColumn is the zero-based index of the column that's hashed to pick a shard.
+// Close must be called to see if any error occurred. Close does not close the writers.
+// EncoderOptions is optional. ColumnOptions.Generate isn't supported.
+func NewShardedEncoder(writers []io.Writer, numColumns, keyColumn int, cfg *EncoderOptions) *ShardedEncoder {
+	s := &ShardedEncoder{
+		encoders:   make([]*Encoder, len(writers)),
+		numColumns: numColumns,
+		keyColumn:  keyColumn,
+		cfg:        cfg,
+		sampler:    cfg.newSampler(),
+		scratch:    make([]byte, 0, 64),
+	}
+	for i, w := range writers {
+		s.encoders[i] = newEncoder(w, numColumns, cfg, nil)
+	}
+	if len(writers) == 0 {
+		s.err = fmt.Errorf("ShardedEncoder needs at least one writer")
+	} else if cfg.hasGeneratedColumns() {
+		s.err = errGeneratedColumns
+	} else if keyColumn < 0 || keyColumn >= numColumns {
+		s.err = fmt.Errorf("key column %d is out of range for %d columns", keyColumn, numColumns)
+	}
+	return s
+}
+
+// AppendRow appends a complete row to the shard its key column hashes to.
+func (s *ShardedEncoder) AppendRow(row []any) {
+	if s.err != nil {
+		return
+	}
+	if len(row) != s.numColumns {
+		s.err = fmt.Errorf("got a row with %d columns, expected %d", len(row), s.numColumns)
+		return
+	}
+	// Rows are sampled before they're routed, so the sample is taken over all rows rather than per shard.
+	if s.sampler != nil && !s.sampler.keep() {
+		return
+	}
+	b, err := appendColumnField(s.scratch[:0], s.scratch, row[s.keyColumn], s.cfg, s.cfg.column(s.keyColumn))
+	if err != nil {
+		s.err = err
+		return
+	}
+	var shard int
+	if b != nil {
+		h := fnv.New32a()
+		h.Write(b)
+		shard = int(h.Sum32() % uint32(len(s.encoders)))
+	}
+	e := s.encoders[shard]
+	for _, v := range row {
+		e.AppendValue(v)
+	}
+	s.err = e.Error()
+}
+
+// Shard returns the Encoder of the i'th shard. Appending to it directly bypasses the key hashing.
+func (s *ShardedEncoder) Shard(i int) *Encoder {
+	return s.encoders[i]
+}
+
+// NumShards returns the number of shards.
+func (s *ShardedEncoder) NumShards() int {
+	return len(s.encoders)
+}
+
+// Close flushes all shards and returns the first error that occurred.
+func (s *ShardedEncoder) Close() error {
+	err := s.err
+	for _, e := range s.encoders {
+		if cerr := e.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (s *ShardedEncoder) Error() error {
+	return s.err
+}
@@ -0,0 +1,50 @@
+package mysqltsv
+
+import (
+	"fmt"
+)
+
+// MySQLShellOptions returns the format of one of the dialects of MySQL Shell's util.importTable: "default", "csv", "tsv" or "csv-unix".
+// Files in these formats can be loaded with the parallel import utility by only passing the dialect and characterSet: 'binary'.
+//
+// util.importTable splits files into chunks at line terminators. The escape character is set for all dialects, so line terminators never occur inside fields and every chunk boundary falls between rows.
+// The "json" dialect isn't supported, as it has neither an enclosure nor an escape character to protect the terminators.
+func MySQLShellOptions(dialect string) (Options, error) {
+	o := DefaultOptions()
+	switch dialect {
+	case "default":
+		o.FieldsEnclosedBy = ""
+		o.FieldsOptionallyEnclosed = false
+	case "csv":
+		o.FieldsTerminatedBy = ","
+		o.LinesTerminatedBy = "\r\n"
+	case "tsv":
+		o.LinesTerminatedBy = "\r\n"
+	case "csv-unix":
+		o.FieldsTerminatedBy = ","
+		o.FieldsOptionallyEnclosed = false
+	case "json":
+		return Options{}, fmt.Errorf("MySQL Shell dialect %q can't escape terminators inside fields, encode JSON documents with the default dialect instead", dialect)
+	default:
+		return Options{}, fmt.Errorf("unknown MySQL Shell dialect %q", dialect)
+	}
+	return o, nil
+}
+
+// MySQLShellImportOptions returns the dialect options for MySQL Shell's util.importTable that match this format, for when none of the predefined dialects fit.
+func (o Options) MySQLShellImportOptions() map[string]any {
+	m := map[string]any{
+		"fieldsTerminatedBy":       o.FieldsTerminatedBy,
+		"fieldsEnclosedBy":         o.FieldsEnclosedBy,
+		"fieldsOptionallyEnclosed": o.FieldsOptionallyEnclosed,
+		"fieldsEscapedBy":          o.FieldsEscapedBy,
+		"linesTerminatedBy":        o.LinesTerminatedBy,
+	}
+	if o.CharacterSet != "" {
+		m["characterSet"] = o.CharacterSet
+	}
+	if len(o.Columns) != 0 {
+		m["columns"] = o.Columns
+	}
+	return m
+}
@@ -0,0 +1,28 @@
+package mysqltsv
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// RowQueryer is implemented by *sql.DB, *sql.Conn and *sql.Tx.
+type RowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// NoBackslashEscapes returns whether the session runs with the NO_BACKSLASH_ESCAPES sql_mode.
+// If it does, use NoBackslashEscapesOptions and NoBackslashEscapesClause, as files in the default format load corrupted.
+// Note that the sql_mode is per session, so q should be the *sql.Conn or *sql.Tx the LOAD DATA statement will run on.
+func NoBackslashEscapes(ctx context.Context, q RowQueryer) (bool, error) {
+	var mode string
+	if err := q.QueryRowContext(ctx, "SELECT @@SESSION.sql_mode").Scan(&mode); err != nil {
+		return false, err
+	}
+	for _, m := range strings.Split(mode, ",") {
+		if strings.EqualFold(m, "NO_BACKSLASH_ESCAPES") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
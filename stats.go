@@ -0,0 +1,108 @@
+package mysqltsv
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+)
+
+// ColumnStats are statistics about the values of one column, collected while encoding if EncoderOptions.ColumnStats is set.
+type ColumnStats struct {
+	// Nulls is the number of NULL values.
+	Nulls int64
+	// Values is the number of non-NULL values.
+	Values int64
+	// MinLength and MaxLength are the shortest and longest length in bytes of the non-NULL values, before escaping.
+	MinLength int
+	MaxLength int
+	// Min and Max are the smallest and largest non-NULL values, compared byte by byte as they were encoded. This matches the natural order of strings and dates, but not of numbers.
+	Min string
+	Max string
+
+	distinct *hyperLogLog
+}
+
+// Distinct returns an estimate of the number of distinct non-NULL values. The estimate is typically within a few percent.
+func (c *ColumnStats) Distinct() uint64 {
+	if c.distinct == nil {
+		return 0
+	}
+	return c.distinct.estimate()
+}
+
+func (c *ColumnStats) add(b []byte) {
+	if b == nil {
+		c.Nulls++
+		return
+	}
+	if c.Values == 0 {
+		c.MinLength = len(b)
+		c.MaxLength = len(b)
+		c.Min = string(b)
+		c.Max = string(b)
+	} else {
+		if len(b) < c.MinLength {
+			c.MinLength = len(b)
+		}
+		if len(b) > c.MaxLength {
+			c.MaxLength = len(b)
+		}
+		if string(b) < c.Min {
+			c.Min = string(b)
+		}
+		if string(b) > c.Max {
+			c.Max = string(b)
+		}
+	}
+	c.Values++
+	c.distinct.add(b)
+}
+
+// ColumnStats returns the statistics for each column collected so far, or nil if EncoderOptions.ColumnStats wasn't set.
+func (e *Encoder) ColumnStats() []ColumnStats {
+	return e.stats
+}
+
+func newColumnStats(numColumns int) []ColumnStats {
+	stats := make([]ColumnStats, numColumns)
+	seed := maphash.MakeSeed()
+	for i := range stats {
+		stats[i].distinct = &hyperLogLog{seed: seed}
+	}
+	return stats
+}
+
+// hyperLogLog estimates the number of distinct values with 4 KiB of memory.
+type hyperLogLog struct {
+	seed      maphash.Seed
+	registers [1 << hllPrecision]uint8
+}
+
+const hllPrecision = 12
+
+func (h *hyperLogLog) add(b []byte) {
+	x := maphash.Bytes(h.seed, b)
+	idx := x >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *hyperLogLog) estimate() uint64 {
+	const m = float64(1 << hllPrecision)
+	var sum float64
+	var zeros int
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small cardinalities.
+		e = m * math.Log(m/float64(zeros))
+	}
+	return uint64(e + 0.5)
+}
@@ -0,0 +1,123 @@
+package mysqltsv
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// structField is a field that's encoded as a column, with the index path to reach it through embedded structs.
+type structField struct {
+	name  string
+	index []int
+}
+
+var structFieldsCache sync.Map // map[reflect.Type][]structField
+
+// structFields returns the columns of struct type t, following the sqlx conventions:
+// the name comes from the db tag or is the lowercased field name, fields tagged db:"-" and unexported fields are skipped, and embedded structs are flattened.
+func structFields(t reflect.Type) []structField {
+	if fields, ok := structFieldsCache.Load(t); ok {
+		return fields.([]structField)
+	}
+	fields := appendStructFields(nil, t, nil)
+	structFieldsCache.Store(t, fields)
+	return fields
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func appendStructFields(fields []structField, t reflect.Type, index []int) []structField {
+	for i := 0; t.NumField() > i; i++ {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("db"), ",")
+		if tag == "-" {
+			continue
+		}
+		idx := append(append([]int(nil), index...), i)
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && tag == "" && ft.Kind() == reflect.Struct && ft != timeType {
+			fields = appendStructFields(fields, ft, idx)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if tag == "" {
+			tag = strings.ToLower(f.Name)
+		}
+		fields = append(fields, structField{name: tag, index: idx})
+	}
+	return fields
+}
+
+// structType returns the struct type behind T, which must be a struct or a pointer to one.
+func structType[T any]() (reflect.Type, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s is not a struct", t)
+	}
+	return t, nil
+}
+
+// StructColumns returns the column names of struct type T, in the order EncodeStructs encodes them.
+// Columns are named like sqlx does: by the db tag, or the lowercased field name. Fields tagged db:"-" are skipped and embedded structs are flattened.
+// T can be a struct or a pointer to one.
+func StructColumns[T any]() ([]string, error) {
+	t, err := structType[T]()
+	if err != nil {
+		return nil, err
+	}
+	fields := structFields(t)
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.name
+	}
+	return names, nil
+}
+
+// EncodeStructs encodes every element of rows as a row into e, with the columns returned by StructColumns.
+// Fields inside a nil embedded pointer are encoded as NULL. It does not Close e. ColumnOptions.Generate isn't supported.
+// T can be a struct or a pointer to one.
+func EncodeStructs[T any](e *Encoder, rows []T) error {
+	t, err := structType[T]()
+	if err != nil {
+		return err
+	}
+	if e.encoderOptions.hasGeneratedColumns() {
+		return errGeneratedColumns
+	}
+	fields := structFields(t)
+	if len(fields) != e.numColumnsPerRow {
+		return fmt.Errorf("%s has %d columns, but the Encoder expects %d", t, len(fields), e.numColumnsPerRow)
+	}
+	for i := range rows {
+		rv := reflect.ValueOf(&rows[i]).Elem()
+		if rv.Kind() == reflect.Pointer {
+			if rv.IsNil() {
+				return fmt.Errorf("row %d is a nil pointer", i)
+			}
+			rv = rv.Elem()
+		}
+		for _, f := range fields {
+			fv, err := rv.FieldByIndexErr(f.index)
+			if err != nil {
+				e.AppendValue(nil)
+				continue
+			}
+			e.AppendValue(fv.Interface())
+		}
+		if err := e.Error(); err != nil {
+			return fmt.Errorf("row %d: %w", i, err)
+		}
+	}
+	return nil
+}
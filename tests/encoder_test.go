@@ -0,0 +1,1986 @@
+package mysqltsv_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hexon/mysqltsv"
+)
+
+func TestEstimateSize(t *testing.T) {
+	rows := [][]any{
+		{1, "hello", nil},
+		{2, "tab\tand\nnewline", []byte{0, 26, '"', '\\'}},
+		{3, "", time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+	est, err := mysqltsv.EstimateSize(rows, nil)
+	if err != nil {
+		t.Fatalf("EstimateSize failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 3, nil)
+	for _, row := range rows {
+		for _, v := range row {
+			e.AppendValue(v)
+		}
+	}
+	if got := e.Size(); got != est {
+		t.Errorf("Encoder.Size() = %d, but EstimateSize returned %d", got, est)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if int64(buf.Len()) != est {
+		t.Errorf("Encoded %d bytes, but EstimateSize returned %d", buf.Len(), est)
+	}
+}
+
+func TestEstimateSizeColumns(t *testing.T) {
+	rows := [][]any{
+		{0, "abc"},
+		{7, "défg"},
+	}
+	cfg := &mysqltsv.EncoderOptions{
+		Columns: []mysqltsv.ColumnOptions{
+			{NullIfZero: true},
+			{Char: mysqltsv.CharPad, CharLength: 10},
+		},
+	}
+	est, err := mysqltsv.EstimateSize(rows, cfg)
+	if err != nil {
+		t.Fatalf("EstimateSize failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, cfg)
+	for _, row := range rows {
+		for _, v := range row {
+			e.AppendValue(v)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if int64(buf.Len()) != est {
+		t.Errorf("Encoded %d bytes, but EstimateSize returned %d", buf.Len(), est)
+	}
+
+	if _, err := mysqltsv.EstimateSize(rows, &mysqltsv.EncoderOptions{Sample: &mysqltsv.SampleOptions{}}); err == nil {
+		t.Errorf("EstimateSize with Sample succeeded")
+	}
+}
+
+func TestEscapeValueTime(t *testing.T) {
+	tests := []struct {
+		in   time.Time
+		want string
+	}{
+		{time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), `"2023-01-02"`},
+		{time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), `"2023-01-02 03:04:05"`},
+		{time.Date(2023, 1, 2, 3, 4, 5, 600000000, time.UTC), `"2023-01-02 03:04:05.6"`},
+	}
+	for _, tc := range tests {
+		got, err := mysqltsv.EscapeValue(tc.in, nil)
+		if err != nil {
+			t.Errorf("EscapeValue(%v) failed: %v", tc.in, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("EscapeValue(%v) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+type nopWriteCloser struct {
+	*bytes.Buffer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestRotatingEncoder(t *testing.T) {
+	var chunks []*bytes.Buffer
+	open := func(n int) (io.WriteCloser, error) {
+		if n != len(chunks) {
+			t.Errorf("Opened chunk %d, expected %d", n, len(chunks))
+		}
+		buf := new(bytes.Buffer)
+		chunks = append(chunks, buf)
+		return nopWriteCloser{buf}, nil
+	}
+	e := mysqltsv.NewRotatingEncoder(2, open, mysqltsv.RotateOptions{MaxRows: 2}, nil)
+	for i := 0; 5 > i; i++ {
+		e.AppendValue(i)
+		e.AppendString("x")
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	want := []string{
+		"\"0\"\t\"x\"\n\"1\"\t\"x\"\n",
+		"\"2\"\t\"x\"\n\"3\"\t\"x\"\n",
+		"\"4\"\t\"x\"\n",
+	}
+	if len(chunks) != len(want) {
+		t.Fatalf("Got %d chunks, want %d", len(chunks), len(want))
+	}
+	for i, buf := range chunks {
+		if buf.String() != want[i] {
+			t.Errorf("Chunk %d = %q, want %q", i, buf.String(), want[i])
+		}
+	}
+}
+
+func TestRotatingEncoderMaxBinlogBytes(t *testing.T) {
+	for _, tc := range []struct {
+		overhead int64
+		want     []int
+	}{
+		// Every row is 4 bytes, so the estimate is 20 bytes per row plus 64 for the event header with the default overhead.
+		{0, []int{5, 5, 2}},
+		{36, []int{3, 3, 3, 3}},
+	} {
+		var chunks []*bytes.Buffer
+		open := func(n int) (io.WriteCloser, error) {
+			buf := new(bytes.Buffer)
+			chunks = append(chunks, buf)
+			return nopWriteCloser{buf}, nil
+		}
+		e := mysqltsv.NewRotatingEncoder(1, open, mysqltsv.RotateOptions{MaxBytes: 1000, MaxBinlogBytes: 164, BinlogRowOverhead: tc.overhead}, nil)
+		for i := 0; 12 > i; i++ {
+			e.AppendString("x")
+		}
+		if err := e.Close(); err != nil {
+			t.Fatalf("Encoding failed: %v", err)
+		}
+		var got []int
+		for _, buf := range chunks {
+			got = append(got, strings.Count(buf.String(), "\n"))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("With overhead %d, got chunks with %v rows, want %v", tc.overhead, got, tc.want)
+		}
+	}
+}
+
+func TestEstimateBinlogSize(t *testing.T) {
+	for _, tc := range []struct {
+		rows, encodedBytes, rowOverhead, want int64
+	}{
+		{0, 0, 16, 64},
+		{10, 100, 16, 100 + 160 + 64},
+		{1, 8192, 0, 8192 + 2*64},
+		{1000, 100000, 16, 100000 + 16000 + 13*64},
+	} {
+		if got := mysqltsv.EstimateBinlogSize(tc.rows, tc.encodedBytes, tc.rowOverhead); got != tc.want {
+			t.Errorf("EstimateBinlogSize(%d, %d, %d) = %d, want %d", tc.rows, tc.encodedBytes, tc.rowOverhead, got, tc.want)
+		}
+	}
+}
+
+func TestGzipEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewGzipEncoder(&buf, 2, nil)
+	e.AppendValue(1)
+	e.AppendString("hello")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("gzip.NewReader failed: %v", err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Decompressing failed: %v", err)
+	}
+	if want := "\"1\"\t\"hello\"\n"; string(got) != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+// closeRecordingCompressor wraps gzip and records which of its writers were closed.
+type closeRecordingCompressor struct {
+	closed int
+}
+
+func (c *closeRecordingCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return &closeRecordingGzipWriter{gzip.NewWriter(w), c}, nil
+}
+
+type closeRecordingGzipWriter struct {
+	*gzip.Writer
+	c *closeRecordingCompressor
+}
+
+func (w *closeRecordingGzipWriter) Close() error {
+	w.c.closed++
+	return w.Writer.Close()
+}
+
+func TestCompressor(t *testing.T) {
+	var buf bytes.Buffer
+	c := &closeRecordingCompressor{}
+	e := mysqltsv.NewEncoder(&buf, 2, &mysqltsv.EncoderOptions{Compressor: mysqltsv.CompressorFunc(c.NewWriter)})
+	e.AppendValue(1)
+	e.AppendString("hello")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if c.closed != 1 {
+		t.Errorf("Compressed writer was closed %d times, want 1", c.closed)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("gzip.NewReader failed: %v", err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Decompressing failed: %v", err)
+	}
+	if want := "\"1\"\t\"hello\"\n"; string(got) != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+
+	writeErr := fmt.Errorf("disk full")
+	c = &closeRecordingCompressor{}
+	e = mysqltsv.NewEncoder(failingWriter{writeErr}, 1, &mysqltsv.EncoderOptions{Compressor: c})
+	e.AppendValue(make(chan int))
+	if err := e.Close(); err == nil {
+		t.Errorf("Close succeeded after an encoding error")
+	}
+	if c.closed != 1 {
+		t.Errorf("Compressed writer was closed %d times after an error, want 1", c.closed)
+	}
+	e.Close()
+	if c.closed != 1 {
+		t.Errorf("Compressed writer was closed again by a second Close")
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 1, &mysqltsv.EncoderOptions{Checksums: true})
+	e.AppendString("a")
+	e.AppendString("b")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	c, ok := e.Checksums()
+	if !ok {
+		t.Fatalf("Checksums() returned false")
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	if want := hex.EncodeToString(sum[:]); c.SHA256 != want {
+		t.Errorf("SHA256 = %s, want %s", c.SHA256, want)
+	}
+	if c.Rows != 2 || c.Bytes != int64(buf.Len()) {
+		t.Errorf("Got %d rows and %d bytes, want 2 and %d", c.Rows, c.Bytes, buf.Len())
+	}
+}
+
+func TestDefaultOptionsClause(t *testing.T) {
+	if got := mysqltsv.DefaultOptions().Clause(); got != mysqltsv.Escaping {
+		t.Errorf("DefaultOptions().Clause() = %s, want %s", got, mysqltsv.Escaping)
+	}
+}
+
+func TestCSVOptions(t *testing.T) {
+	opts := mysqltsv.CSVOptions()
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 3, &mysqltsv.EncoderOptions{Dialect: &opts})
+	e.AppendValue(1)
+	e.AppendString("say \"hi\",\nbye\\")
+	e.AppendValue(nil)
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\"1\",\"say \"\"hi\"\",\nbye\\\",NULL\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+	if want := `CHARACTER SET binary FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '' LINES TERMINATED BY '\n' STARTING BY ''`; opts.Clause() != want {
+		t.Errorf("Clause() = %s, want %s", opts.Clause(), want)
+	}
+}
+
+func TestCRLF(t *testing.T) {
+	opts := mysqltsv.DefaultOptions()
+	opts.LinesTerminatedBy = "\r\n"
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, &mysqltsv.EncoderOptions{Dialect: &opts})
+	e.AppendString("a\r\nb")
+	e.AppendValue(nil)
+	e.AppendString("c")
+	e.AppendString("d")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\"a\\r\\nb\"\t\\N\r\n\"c\"\t\"d\"\r\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+	if want := `CHARACTER SET binary FIELDS TERMINATED BY '\t' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '\\' LINES TERMINATED BY '\r\n' STARTING BY ''`; opts.Clause() != want {
+		t.Errorf("Clause() = %s, want %s", opts.Clause(), want)
+	}
+}
+
+func TestLinesStartingBy(t *testing.T) {
+	opts := mysqltsv.DefaultOptions()
+	opts.LinesStartingBy = "xxx "
+	cfg := &mysqltsv.EncoderOptions{Dialect: &opts}
+	rows := [][]any{{1, "a"}, {2, "xxx b"}}
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, cfg)
+	for _, row := range rows {
+		for _, v := range row {
+			e.AppendValue(v)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "xxx \"1\"\t\"a\"\nxxx \"2\"\t\"xxx b\"\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+	if est, err := mysqltsv.EstimateSize(rows, cfg); err != nil || est != int64(buf.Len()) {
+		t.Errorf("EstimateSize() = %d, %v; want %d", est, err, buf.Len())
+	}
+}
+
+func TestUnenclosed(t *testing.T) {
+	opts := mysqltsv.DefaultOptions()
+	opts.FieldsTerminatedBy = ","
+	opts.FieldsEnclosedBy = ""
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 3, &mysqltsv.EncoderOptions{Dialect: &opts})
+	e.AppendString("a,b\n\"c\"")
+	e.AppendValue(nil)
+	e.AppendString("NULL")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "a\\,b\\n\"c\",\\N,NULL\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+	if want := `CHARACTER SET binary FIELDS TERMINATED BY ',' ENCLOSED BY '' ESCAPED BY '\\' LINES TERMINATED BY '\n' STARTING BY ''`; opts.Clause() != want {
+		t.Errorf("Clause() = %s, want %s", opts.Clause(), want)
+	}
+}
+
+func TestEncloseOnlyWhenNeeded(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 5, &mysqltsv.EncoderOptions{EncloseOnlyWhenNeeded: true})
+	e.AppendValue(123)
+	e.AppendString("plain")
+	e.AppendString("tab\there")
+	e.AppendString("NULL")
+	e.AppendValue(nil)
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "123\tplain\t\"tab\\there\"\t\"NULL\"\t\\N\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestNullLiteral(t *testing.T) {
+	opts := mysqltsv.DefaultOptions()
+	opts.NullLiteral = ""
+	opts.CustomNullLiteral = true
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 3, &mysqltsv.EncoderOptions{Dialect: &opts, EncloseOnlyWhenNeeded: true})
+	e.AppendValue(nil)
+	e.AppendString("")
+	e.AppendString("x")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\t\"\"\tx\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestNoBackslashEscapes(t *testing.T) {
+	opts := mysqltsv.NoBackslashEscapesOptions()
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, &mysqltsv.EncoderOptions{Dialect: &opts})
+	e.AppendString("a\\\"b\tc")
+	e.AppendValue(nil)
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\"a\\\"\"b\tc\"\tNULL\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+	if want := "CHARACTER SET binary FIELDS TERMINATED BY '\t' OPTIONALLY ENCLOSED BY '\"' ESCAPED BY '' LINES TERMINATED BY '\n' STARTING BY ''"; opts.NoBackslashEscapesClause() != want {
+		t.Errorf("NoBackslashEscapesClause() = %q, want %q", opts.NoBackslashEscapesClause(), want)
+	}
+}
+
+// upperTranscoder is a stand-in for a golang.org/x/text encoder.
+type upperTranscoder struct{}
+
+func (upperTranscoder) Bytes(b []byte) ([]byte, error) {
+	return bytes.ToUpper(b), nil
+}
+
+func TestTranscoder(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 3, &mysqltsv.EncoderOptions{Transcoder: upperTranscoder{}})
+	e.AppendString("abc")
+	e.AppendBytes([]byte("abc"))
+	e.AppendString("")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\"ABC\"\t\"abc\"\t\"\"\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestMultibyteCharset(t *testing.T) {
+	opts := mysqltsv.DefaultOptions()
+	opts.CharacterSet = "gbk"
+	// 0x955C is a GBK character whose second byte is a backslash.
+	got, err := mysqltsv.EscapeValue([]byte{0x95, 0x5C, '\\', '"'}, &mysqltsv.EncoderOptions{Dialect: &opts})
+	if err != nil {
+		t.Fatalf("EscapeValue failed: %v", err)
+	}
+	if want := []byte{'"', 0x95, 0x5C, '\\', '\\', '\\', '"', '"'}; !bytes.Equal(got, want) {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+func TestUTF8MB4Options(t *testing.T) {
+	opts := mysqltsv.UTF8MB4Options()
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 1, &mysqltsv.EncoderOptions{Dialect: &opts})
+	e.AppendString("héllo")
+	e.AppendString("\xff")
+	if err := e.Close(); err == nil {
+		t.Errorf("Encoding invalid UTF-8 succeeded")
+	}
+
+	e = mysqltsv.NewEncoder(&buf, 1, &mysqltsv.EncoderOptions{Dialect: &opts})
+	e.AppendValue([]byte{1, 2})
+	if err := e.Close(); err == nil {
+		t.Errorf("Encoding binary value succeeded")
+	}
+
+	buf.Reset()
+	e = mysqltsv.NewEncoder(&buf, 1, &mysqltsv.EncoderOptions{Dialect: &opts, HexBinary: true})
+	e.AppendValue([]byte{1, 0xff})
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\"01ff\"\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestXMLEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewXMLEncoder(&buf, []string{"id", "name"}, nil)
+	e.AppendValue(1)
+	e.AppendString("<a & b>")
+	e.AppendValue(2)
+	e.AppendValue(nil)
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	want := `<?xml version="1.0"?>
+<resultset xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<row>
+	<field name="id">1</field>
+	<field name="name">&lt;a &amp; b&gt;</field>
+</row>
+<row>
+	<field name="id">2</field>
+	<field name="name" xsi:nil="true" />
+</row>
+</resultset>
+`
+	if buf.String() != want {
+		t.Errorf("Got %s, want %s", buf.String(), want)
+	}
+}
+
+func TestMySQLShellOptions(t *testing.T) {
+	for _, tc := range []struct {
+		dialect string
+		want    map[string]any
+	}{
+		{"default", map[string]any{"fieldsTerminatedBy": "\t", "fieldsEnclosedBy": "", "fieldsOptionallyEnclosed": false, "fieldsEscapedBy": "\\", "linesTerminatedBy": "\n", "characterSet": "binary"}},
+		{"csv", map[string]any{"fieldsTerminatedBy": ",", "fieldsEnclosedBy": `"`, "fieldsOptionallyEnclosed": true, "fieldsEscapedBy": "\\", "linesTerminatedBy": "\r\n", "characterSet": "binary"}},
+		{"tsv", map[string]any{"fieldsTerminatedBy": "\t", "fieldsEnclosedBy": `"`, "fieldsOptionallyEnclosed": true, "fieldsEscapedBy": "\\", "linesTerminatedBy": "\r\n", "characterSet": "binary"}},
+		{"csv-unix", map[string]any{"fieldsTerminatedBy": ",", "fieldsEnclosedBy": `"`, "fieldsOptionallyEnclosed": false, "fieldsEscapedBy": "\\", "linesTerminatedBy": "\n", "characterSet": "binary"}},
+		{"json", nil},
+		{"excel", nil},
+	} {
+		o, err := mysqltsv.MySQLShellOptions(tc.dialect)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("MySQLShellOptions(%q) succeeded", tc.dialect)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("MySQLShellOptions(%q) failed: %v", tc.dialect, err)
+			continue
+		}
+		if err := o.Validate(); err != nil {
+			t.Errorf("MySQLShellOptions(%q) isn't valid: %v", tc.dialect, err)
+		}
+		if got := o.MySQLShellImportOptions(); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("MySQLShellOptions(%q).MySQLShellImportOptions() = %v, want %v", tc.dialect, got, tc.want)
+		}
+	}
+
+	o := mysqltsv.DefaultOptions()
+	o.CharacterSet = ""
+	o.Columns = []string{"id", "name"}
+	got := o.MySQLShellImportOptions()
+	if _, ok := got["characterSet"]; ok {
+		t.Errorf("MySQLShellImportOptions() has a characterSet without a CharacterSet: %v", got)
+	}
+	if fmt.Sprint(got["columns"]) != "[id name]" {
+		t.Errorf("MySQLShellImportOptions() has columns %v, want [id name]", got["columns"])
+	}
+}
+
+func TestIntoOutfileClause(t *testing.T) {
+	want := `INTO OUTFILE '/tmp/it\'s.tsv' ` + mysqltsv.Escaping
+	if got := mysqltsv.DefaultOptions().IntoOutfileClause("/tmp/it's.tsv"); got != want {
+		t.Errorf("IntoOutfileClause() = %s, want %s", got, want)
+	}
+}
+
+func TestFromCSV(t *testing.T) {
+	in := "name,id,score\nalice,1,\nbob,2,3.5\n"
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 3, nil)
+	n, err := mysqltsv.FromCSV(csv.NewReader(strings.NewReader(in)), e, &mysqltsv.CSVMapping{
+		SkipHeader:  true,
+		Fields:      []int{1, 0, 2},
+		EmptyIsNull: true,
+	})
+	if err != nil {
+		t.Fatalf("FromCSV failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("FromCSV encoded %d records, want 2", n)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\"1\"\t\"alice\"\t\\N\n\"2\"\t\"bob\"\t\"3.5\"\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestFromCSVFieldsMismatch(t *testing.T) {
+	e := mysqltsv.NewEncoder(io.Discard, 3, nil)
+	for _, fields := range [][]int{{0, 1}, {0, 1, 2, 3}} {
+		if _, err := mysqltsv.FromCSV(csv.NewReader(strings.NewReader("a,b,c\n")), e, &mysqltsv.CSVMapping{Fields: fields}); err == nil {
+			t.Errorf("FromCSV accepted Fields %v for 3 columns", fields)
+		}
+	}
+}
+
+func TestFromCSVConvertError(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, nil)
+	n, err := mysqltsv.FromCSV(csv.NewReader(strings.NewReader("1,2\n4,x\n")), e, &mysqltsv.CSVMapping{
+		Convert: func(col int, field string) (any, error) {
+			return strconv.Atoi(field)
+		},
+	})
+	if err == nil {
+		t.Fatalf("FromCSV accepted an invalid number")
+	}
+	if n != 1 {
+		t.Errorf("FromCSV encoded %d records, want 1", n)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if want := "\"1\"\t\"2\"\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestFromJSONLines(t *testing.T) {
+	in := `{"id": 1, "user": {"name": "alice"}, "tags": ["a"], "ok": true}
+{"id": 12345678901234567890, "user": null}
+`
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 4, nil)
+	n, err := mysqltsv.FromJSONLines(strings.NewReader(in), e, []string{"id", "user.name", "tags", "ok"})
+	if err != nil {
+		t.Fatalf("FromJSONLines failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("FromJSONLines encoded %d rows, want 2", n)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\"1\"\t\"alice\"\t\"[\\\"a\\\"]\"\t\"1\"\n\"12345678901234567890\"\t\\N\t\\N\t\\N\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+}
+
+type structBase struct {
+	ID int64 `db:"id"`
+}
+
+type structRow struct {
+	structBase
+	Name     string
+	Email    string `db:"email_address"`
+	internal string
+	Ignored  string `db:"-"`
+}
+
+func TestEncodeStructs(t *testing.T) {
+	cols, err := mysqltsv.StructColumns[structRow]()
+	if err != nil {
+		t.Fatalf("StructColumns failed: %v", err)
+	}
+	if got, want := strings.Join(cols, ","), "id,name,email_address"; got != want {
+		t.Errorf("StructColumns() = %s, want %s", got, want)
+	}
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, len(cols), nil)
+	rows := []*structRow{{structBase: structBase{ID: 1}, Name: "alice", Email: "a@example.com", internal: "x", Ignored: "y"}}
+	if err := mysqltsv.EncodeStructs(e, rows); err != nil {
+		t.Fatalf("EncodeStructs failed: %v", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\"1\"\t\"alice\"\t\"a@example.com\"\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	for _, o := range []mysqltsv.Options{mysqltsv.DefaultOptions(), mysqltsv.CSVOptions(), mysqltsv.NoBackslashEscapesOptions(), mysqltsv.UTF8MB4Options()} {
+		if err := o.Validate(); err != nil {
+			t.Errorf("Validate() of %s failed: %v", o.Clause(), err)
+		}
+	}
+	bad := []func(o *mysqltsv.Options){
+		func(o *mysqltsv.Options) { o.FieldsEnclosedBy = "\t" },
+		func(o *mysqltsv.Options) { o.FieldsEscapedBy = "\\\\" },
+		func(o *mysqltsv.Options) { o.LinesTerminatedBy = "" },
+		func(o *mysqltsv.Options) { o.NullLiteral = "a\tb" },
+		func(o *mysqltsv.Options) { o.FieldsEnclosedBy = ""; o.FieldsEscapedBy = "" },
+		func(o *mysqltsv.Options) { o.NullLiteral = "" },
+		func(o *mysqltsv.Options) { o.FieldsEnclosedBy = ""; o.NullLiteral = "NULL" },
+	}
+	for i, f := range bad {
+		o := mysqltsv.DefaultOptions()
+		f(&o)
+		if err := o.Validate(); err == nil {
+			t.Errorf("Validate() of bad options %d succeeded", i)
+		}
+	}
+}
+
+func TestNullIfZeroNilPointer(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 1, &mysqltsv.EncoderOptions{Columns: []mysqltsv.ColumnOptions{{NullIfZero: true}}})
+	e.AppendValue((*time.Time)(nil))
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, want := buf.String(), "\\N\n"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+func TestNullIfZeroEmptySlice(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, &mysqltsv.EncoderOptions{Columns: []mysqltsv.ColumnOptions{{NullIfZero: true}, {NullIfZero: true}}})
+	e.AppendValue([]byte{})
+	e.AppendBytes([]byte{})
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, want := buf.String(), "\\N\t\\N\n"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+func TestNullIfZero(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 4, &mysqltsv.EncoderOptions{
+		Columns: []mysqltsv.ColumnOptions{{NullIfZero: true}, {NullIfZero: true}, {NullIfZero: true}},
+	})
+	e.AppendValue(0)
+	e.AppendString("")
+	e.AppendValue(time.Time{})
+	e.AppendValue(0)
+	e.AppendValue(1)
+	e.AppendString("a")
+	e.AppendValue(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC))
+	e.AppendValue(0)
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\\N\t\\N\t\\N\t\"0\"\n\"1\"\t\"a\"\t\"2023-01-02\"\t\"0\"\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestExtraColumns(t *testing.T) {
+	cfg := &mysqltsv.EncoderOptions{ExtraColumns: []any{"batch-1", 42}}
+	rows := [][]any{{1}, {2}}
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 1, cfg)
+	for _, row := range rows {
+		e.AppendValue(row[0])
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\"1\"\t\"batch-1\"\t\"42\"\n\"2\"\t\"batch-1\"\t\"42\"\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+	if est, err := mysqltsv.EstimateSize(rows, cfg); err != nil || est != int64(buf.Len()) {
+		t.Errorf("EstimateSize() = %d, %v; want %d", est, err, buf.Len())
+	}
+}
+
+func TestGenerateColumn(t *testing.T) {
+	var next int
+	gen := func() any {
+		next++
+		return next
+	}
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 3, &mysqltsv.EncoderOptions{
+		Columns: []mysqltsv.ColumnOptions{{Generate: gen}, {}, {Generate: mysqltsv.UUIDv7}},
+	})
+	e.AppendString("a")
+	e.AppendString("b")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Got %d lines, want 2: %q", len(lines), buf.String())
+	}
+	for i, line := range lines {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || fields[0] != fmt.Sprintf("\"%d\"", i+1) || len(fields[2]) != 38 || fields[2][15] != '7' {
+			t.Errorf("Unexpected line %q", line)
+		}
+	}
+}
+
+func TestRowHash(t *testing.T) {
+	cfg := &mysqltsv.EncoderOptions{RowHash: sha256.New, ExtraColumns: []any{"x"}}
+	rows := [][]any{{1, "a"}}
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, cfg)
+	e.AppendValue(1)
+	e.AppendString("a")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	sum := sha256.Sum256([]byte("\"1\"\t\"a\"\t"))
+	if want := "\"1\"\t\"a\"\t\"" + hex.EncodeToString(sum[:]) + "\"\t\"x\"\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+	if est, err := mysqltsv.EstimateSize(rows, cfg); err != nil || est != int64(buf.Len()) {
+		t.Errorf("EstimateSize() = %d, %v; want %d", est, err, buf.Len())
+	}
+}
+
+func TestColumnStats(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, &mysqltsv.EncoderOptions{ColumnStats: true})
+	for i := 0; 1000 > i; i++ {
+		e.AppendValue(i)
+		if i%10 == 0 {
+			e.AppendValue(nil)
+		} else {
+			e.AppendString(strings.Repeat("x", i%5+1))
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	stats := e.ColumnStats()
+	if d := stats[0].Distinct(); d < 950 || d > 1050 {
+		t.Errorf("Distinct() of column 0 = %d, want about 1000", d)
+	}
+	if stats[1].Nulls != 100 || stats[1].Values != 900 || stats[1].MinLength != 1 || stats[1].MaxLength != 5 || stats[1].Min != "x" || stats[1].Max != "xxxxx" {
+		t.Errorf("Unexpected stats for column 1: %+v", stats[1])
+	}
+	// Distinct values can share an estimator register, which lowers the estimate.
+	if d := stats[1].Distinct(); d < 4 || d > 6 {
+		t.Errorf("Distinct() of column 1 = %d, want about 5", d)
+	}
+}
+
+func TestSample(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, &mysqltsv.EncoderOptions{Sample: &mysqltsv.SampleOptions{Every: 3}})
+	for i := 0; 7 > i; i++ {
+		e.AppendValue(i)
+		e.AppendString("x")
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\"0\"\t\"x\"\n\"3\"\t\"x\"\n\"6\"\t\"x\"\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+	if e.Rows() != 3 {
+		t.Errorf("Rows() = %d, want 3", e.Rows())
+	}
+}
+
+func TestSampleWrappers(t *testing.T) {
+	cfg := &mysqltsv.EncoderOptions{Sample: &mysqltsv.SampleOptions{Every: 3}}
+
+	chunks := map[int]*recordingWriteCloser{}
+	r := mysqltsv.NewRotatingEncoder(1, func(n int) (io.WriteCloser, error) {
+		chunks[n] = &recordingWriteCloser{}
+		return chunks[n], nil
+	}, mysqltsv.RotateOptions{MaxRows: 2}, cfg)
+	for i := 0; 12 > i; i++ {
+		r.AppendValue(i)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	var got string
+	for n := 0; len(chunks) > n; n++ {
+		got += chunks[n].String()
+	}
+	if want := "\"0\"\n\"3\"\n\"6\"\n\"9\"\n"; got != want {
+		t.Errorf("RotatingEncoder sampled %q, want %q", got, want)
+	}
+
+	bufs := []*bytes.Buffer{new(bytes.Buffer), new(bytes.Buffer)}
+	s := mysqltsv.NewShardedEncoder([]io.Writer{bufs[0], bufs[1]}, 1, 0, cfg)
+	for i := 0; 12 > i; i++ {
+		s.AppendRow([]any{i})
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(bufs[0].String()+bufs[1].String()), "\n")
+	sort.Strings(lines)
+	if want := []string{`"0"`, `"3"`, `"6"`, `"9"`}; fmt.Sprint(lines) != fmt.Sprint(want) {
+		t.Errorf("ShardedEncoder kept %v, want %v", lines, want)
+	}
+
+	var keys []string
+	p := mysqltsv.NewPartitionedEncoder(2, 1, func(key string, null bool) (io.WriteCloser, error) {
+		keys = append(keys, key)
+		return &recordingWriteCloser{}, nil
+	}, cfg)
+	for i := 0; 12 > i; i++ {
+		p.AppendRow([]any{i, i % 3})
+	}
+	if err := p.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if want := []string{"0"}; fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("PartitionedEncoder opened partitions %v, want %v", keys, want)
+	}
+}
+
+func TestAppendTimeLayout(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, &mysqltsv.EncoderOptions{Location: time.UTC})
+	ts := time.Date(2023, 1, 2, 3, 4, 5, 0, time.FixedZone("X", 3600))
+	e.AppendTimeLayout(ts, "15:04")
+	e.AppendTimeLayoutIn(ts, "2006-01-02 15:04", time.FixedZone("Y", 7200))
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\"02:04\"\t\"2023-01-02 04:04\"\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestAppendDateAndDateTime(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 3, nil)
+	e.AppendDate(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+	e.AppendDateTime(time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC))
+	e.AppendDateTime(time.Date(2023, 1, 2, 0, 0, 0, 5000, time.UTC))
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	if want := "\"2023-01-02\"\t\"2023-01-02 00:00:00\"\t\"2023-01-02 00:00:00.000005\"\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestCreateTableStatement(t *testing.T) {
+	type row struct {
+		ID      int64  `db:"id"`
+		UUID    string `db:"uuid" mysqltsv:"CHAR(36) NOT NULL"`
+		Comment *string
+		Created time.Time
+		Score   mysqltsv.Nullable[float64]
+	}
+	got, err := mysqltsv.CreateTableStatement[row]("staging")
+	if err != nil {
+		t.Fatalf("CreateTableStatement failed: %v", err)
+	}
+	want := "CREATE TABLE `staging` (\n\t`id` BIGINT NOT NULL,\n\t`uuid` CHAR(36) NOT NULL,\n\t`comment` VARCHAR(255) NULL,\n\t`created` DATETIME(6) NOT NULL,\n\t`score` DOUBLE NULL\n)"
+	if got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+}
+
+func TestColumnList(t *testing.T) {
+	got := mysqltsv.ColumnList([]string{"id", "we`ird"})
+	want := "(`id`, `we``ird`)"
+	if got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+}
+
+func TestDialectColumns(t *testing.T) {
+	opts := mysqltsv.DefaultOptions()
+	opts.Columns = []string{"id", "name", "hash"}
+	if want := mysqltsv.Escaping + " (`id`, `name`, `hash`)"; opts.Clause() != want {
+		t.Errorf("Clause() = %s, want %s", opts.Clause(), want)
+	}
+	if want := "INTO OUTFILE 'out.tsv' " + mysqltsv.Escaping; opts.IntoOutfileClause("out.tsv") != want {
+		t.Errorf("IntoOutfileClause() = %s, want %s", opts.IntoOutfileClause("out.tsv"), want)
+	}
+
+	e := mysqltsv.NewEncoder(io.Discard, 2, &mysqltsv.EncoderOptions{Dialect: &opts, RowHash: sha256.New})
+	e.AppendValue(1)
+	e.AppendValue("alice")
+	if err := e.Close(); err != nil {
+		t.Errorf("Encoding with matching Columns failed: %v", err)
+	}
+	e = mysqltsv.NewEncoder(io.Discard, 2, &mysqltsv.EncoderOptions{Dialect: &opts})
+	if err := e.Close(); err == nil {
+		t.Errorf("NewEncoder accepted 3 Columns for 2 fields")
+	}
+
+	opts.Columns = []string{"id", "ID"}
+	if err := opts.Validate(); err == nil {
+		t.Errorf("Validate accepted a duplicate column")
+	}
+}
+
+func TestParseLoadInfo(t *testing.T) {
+	got, err := mysqltsv.ParseLoadInfo("Records: 5  Deleted: 1  Skipped: 2  Warnings: 3")
+	if err != nil {
+		t.Fatalf("ParseLoadInfo failed: %v", err)
+	}
+	want := mysqltsv.LoadInfo{Records: 5, Deleted: 1, Skipped: 2, Warnings: 3}
+	if got != want {
+		t.Errorf("Got %+v, want %+v", got, want)
+	}
+	if _, err := mysqltsv.ParseLoadInfo("Rows matched: 1"); err == nil {
+		t.Errorf("ParseLoadInfo accepted an UPDATE info string")
+	}
+}
+
+func TestNullable(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, nil)
+	e.AppendValue(mysqltsv.NewNullable[int32](7))
+	e.AppendValue(mysqltsv.Nullable[string]{})
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, want := buf.String(), "\"7\"\t\\N\n"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+func TestByteArray(t *testing.T) {
+	type hash [4]byte
+	got, err := mysqltsv.EscapeValue(hash{'a', 'b', '\t', 'c'}, &mysqltsv.EncoderOptions{HexBinary: true})
+	if err != nil {
+		t.Fatalf("EscapeValue failed: %v", err)
+	}
+	if want := `"61620963"`; string(got) != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+}
+
+func TestCharPadding(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, &mysqltsv.EncoderOptions{
+		Columns: []mysqltsv.ColumnOptions{
+			{Char: mysqltsv.CharTrim},
+			{Char: mysqltsv.CharPad, CharLength: 4},
+		},
+	})
+	e.AppendString("ab  ")
+	e.AppendBytes([]byte("é"))
+	e.AppendValue(nil)
+	e.AppendString("abcde")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, want := buf.String(), "\"ab\"\t\"é   \"\n\\N\t\"abcde\"\n"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+type point struct{ x, y int }
+
+func (p point) AppendFieldTo(w mysqltsv.FieldWriter) error {
+	fmt.Fprintf(w, "POINT(%d %d)", p.x, p.y)
+	return w.WriteByte('\t')
+}
+
+func TestFieldAppender(t *testing.T) {
+	got, err := mysqltsv.EscapeValue(point{1, 2}, nil)
+	if err != nil {
+		t.Fatalf("EscapeValue failed: %v", err)
+	}
+	if want := "\"POINT(1 2)\\t\""; string(got) != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+}
+
+func TestEpochColumn(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, &mysqltsv.EncoderOptions{
+		Columns: []mysqltsv.ColumnOptions{
+			{Epoch: mysqltsv.EpochSeconds},
+			{Epoch: mysqltsv.EpochMilliseconds},
+		},
+	})
+	ts := time.Date(2023, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	e.AppendValue(ts)
+	e.AppendValue(ts)
+	e.AppendValue(sql.NullTime{Time: ts, Valid: true})
+	e.AppendValue(&ts)
+	e.AppendValue(mysqltsv.NewNullable(ts))
+	e.AppendValue(sql.NullTime{})
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, want := buf.String(), "\"1672628645\"\t\"1672628645006\"\n\"1672628645\"\t\"1672628645006\"\n\"1672628645\"\t\\N\n"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+func TestManifest(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 1, &mysqltsv.EncoderOptions{Checksums: true})
+	e.AppendString("a")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	m := e.Manifest([]mysqltsv.ManifestColumn{{Name: "name", Type: "VARCHAR(255) NOT NULL"}})
+	if m.Clause != mysqltsv.Escaping || m.Rows != 1 || m.Bytes != 4 || m.Checksums == nil {
+		t.Errorf("Unexpected manifest %+v", m)
+	}
+	var out bytes.Buffer
+	if err := m.WriteSidecar(&out); err != nil {
+		t.Fatalf("WriteSidecar failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `"fields_terminated_by": "\t"`) {
+		t.Errorf("Sidecar doesn't contain the dialect: %s", out.String())
+	}
+}
+
+func TestColumnLocation(t *testing.T) {
+	var buf bytes.Buffer
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skipf("No timezone database: %v", err)
+	}
+	e := mysqltsv.NewEncoder(&buf, 2, &mysqltsv.EncoderOptions{
+		Location: amsterdam,
+		Columns:  []mysqltsv.ColumnOptions{{Location: time.UTC}},
+	})
+	ts := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	e.AppendValue(ts)
+	e.AppendValue(ts)
+	e.AppendValue(sql.NullTime{Time: ts, Valid: true})
+	e.AppendValue(sql.NullTime{Time: ts, Valid: true})
+	e.AppendValue(&ts)
+	e.AppendValue(&ts)
+	e.AppendValue(mysqltsv.NewNullable(ts))
+	e.AppendValue(mysqltsv.NewNullable(ts))
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, want := buf.String(), strings.Repeat("\"2023-01-02 03:04:05\"\t\"2023-01-02 04:04:05\"\n", 4); got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	for _, tc := range []struct {
+		v    any
+		want string
+	}{
+		{nil, "NULL"},
+		{true, "'1'"},
+		{"it's", `'it\'s'`},
+		{time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), "'2023-01-02'"},
+		{[]byte("ab"), "X'6162'"},
+		{[]byte{0xff, 0}, "X'ff00'"},
+		{[]byte{}, "X''"},
+	} {
+		got, err := mysqltsv.FormatValue(tc.v, nil)
+		if err != nil {
+			t.Errorf("FormatValue(%v) failed: %v", tc.v, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestFormatValueIgnoresFileOptions(t *testing.T) {
+	opts := mysqltsv.UTF8MB4Options()
+	cfg := &mysqltsv.EncoderOptions{Transcoder: upperTranscoder{}, Dialect: &opts}
+	for _, tc := range []struct {
+		v    any
+		want string
+	}{
+		{"abc", "'abc'"},
+		{[]byte{0xff}, "X'ff'"},
+	} {
+		got, err := mysqltsv.FormatValue(tc.v, cfg)
+		if err != nil {
+			t.Errorf("FormatValue(%v) failed: %v", tc.v, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestSortedEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewSortedEncoder(&buf, 2, []int{0}, mysqltsv.CanonicalOptions())
+	e.AppendString("b")
+	e.AppendValue(1)
+	e.AppendValue(nil)
+	e.AppendValue(2)
+	e.AppendBytes([]byte("a"))
+	e.AppendValue(3)
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, want := buf.String(), "\\N\t\"2\"\n\"a\"\t\"3\"\n\"b\"\t\"1\"\n"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+func TestSortedEncoderColumnOptions(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := mysqltsv.CanonicalOptions()
+	cfg.Columns = []mysqltsv.ColumnOptions{{NullIfZero: true}}
+	e := mysqltsv.NewSortedEncoder(&buf, 2, []int{0}, cfg)
+	e.AppendValue(5)
+	e.AppendValue("a")
+	e.AppendValue(0)
+	e.AppendValue("b")
+	e.AppendValue(nil)
+	e.AppendValue("c")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, want := buf.String(), "\\N\t\"b\"\n\\N\t\"c\"\n\"5\"\t\"a\"\n"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+func TestFloatFormat(t *testing.T) {
+	got, err := mysqltsv.FormatValue(1234.5678, &mysqltsv.EncoderOptions{FloatFormat: 'e', FloatPrecision: intPtr(2)})
+	if err != nil {
+		t.Fatalf("FormatValue failed: %v", err)
+	}
+	if want := "'1.23e+03'"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	got, err = mysqltsv.FormatValue(1234.5678, &mysqltsv.EncoderOptions{FloatPrecision: intPtr(0)})
+	if err != nil {
+		t.Fatalf("FormatValue failed: %v", err)
+	}
+	if want := "'1235'"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+	got, err = mysqltsv.FormatValue(float32(0.1), nil)
+	if err != nil {
+		t.Fatalf("FormatValue failed: %v", err)
+	}
+	if want := "'0.1'"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+}
+
+func TestBigInt(t *testing.T) {
+	n, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	for _, v := range []any{n, *n} {
+		got, err := mysqltsv.FormatValue(v, nil)
+		if err != nil {
+			t.Fatalf("FormatValue failed: %v", err)
+		}
+		if want := "'123456789012345678901234567890'"; got != want {
+			t.Errorf("Got %s, want %s", got, want)
+		}
+	}
+	if got, _ := mysqltsv.FormatValue((*big.Int)(nil), nil); got != "NULL" {
+		t.Errorf("Got %s for a nil *big.Int, want NULL", got)
+	}
+}
+
+func TestBigFloatAndRat(t *testing.T) {
+	for _, tc := range []struct {
+		v             any
+		decimalPlaces *int
+		want          string
+	}{
+		{big.NewFloat(1.5), nil, "'1.5'"},
+		{big.NewFloat(1.5), intPtr(3), "'1.500'"},
+		{big.NewFloat(2.75), intPtr(0), "'3'"},
+		{big.NewRat(1, 3), intPtr(4), "'0.3333'"},
+		{big.NewRat(6, 3), nil, "'2'"},
+		{big.NewRat(5, 3), intPtr(0), "'2'"},
+	} {
+		got, err := mysqltsv.FormatValue(tc.v, &mysqltsv.EncoderOptions{DecimalPlaces: tc.decimalPlaces})
+		if err != nil {
+			t.Errorf("FormatValue(%v) failed: %v", tc.v, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+	if _, err := mysqltsv.FormatValue(big.NewRat(1, 3), nil); err == nil {
+		t.Errorf("FormatValue accepted an inexact *big.Rat")
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+type fixedDecimal struct {
+	units int64
+	scale int
+}
+
+func (d fixedDecimal) AppendMySQLTSV(dst []byte) []byte {
+	s := fmt.Sprintf("%0*d", d.scale+1, d.units)
+	return append(append(append(dst, s[:len(s)-d.scale]...), '.'), s[len(s)-d.scale:]...)
+}
+
+type registeredDecimal struct{ s string }
+
+func TestAppender(t *testing.T) {
+	mysqltsv.RegisterAppender(func(dst []byte, d registeredDecimal) []byte {
+		return append(dst, d.s...)
+	})
+	for _, tc := range []struct {
+		v    any
+		want string
+	}{
+		{fixedDecimal{1500, 3}, "'1.500'"},
+		{registeredDecimal{"2.50"}, "'2.50'"},
+	} {
+		got, err := mysqltsv.FormatValue(tc.v, nil)
+		if err != nil {
+			t.Errorf("FormatValue(%v) failed: %v", tc.v, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestSQLNullTypes(t *testing.T) {
+	values := []any{
+		sql.NullString{String: "a", Valid: true},
+		sql.NullInt64{Int64: 64, Valid: true},
+		sql.NullInt32{Int32: 32, Valid: true},
+		sql.NullInt16{Int16: 16, Valid: true},
+		sql.NullByte{Byte: 8, Valid: true},
+		sql.NullFloat64{Float64: 1.5, Valid: true},
+		sql.NullBool{Bool: true, Valid: true},
+		sql.NullTime{Time: time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC), Valid: true},
+	}
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, len(values), nil)
+	for _, v := range values {
+		e.AppendValue(v)
+	}
+	for _, v := range []any{sql.NullString{}, sql.NullInt64{}, sql.NullInt32{}, sql.NullInt16{}, sql.NullByte{}, sql.NullFloat64{}, sql.NullBool{}, sql.NullTime{}} {
+		e.AppendValue(v)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	want := "\"a\"\t\"64\"\t\"32\"\t\"16\"\t\"8\"\t\"1.5\"\t\"1\"\t\"2023-01-02\"\n" + strings.Repeat("\\N\t", 7) + "\\N\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+func TestPointers(t *testing.T) {
+	s := "a"
+	n := int64(5)
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	addr := netip.MustParseAddr("192.0.2.1")
+	var nilTime *time.Time
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 6, nil)
+	e.AppendValue(&s)
+	e.AppendValue(&n)
+	e.AppendValue(&ts)
+	e.AppendValue(&addr)
+	e.AppendValue((*string)(nil))
+	e.AppendValue(nilTime)
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, want := buf.String(), "\"a\"\t\"5\"\t\"2024-01-02 03:04:05\"\t\"192.0.2.1\"\t\\N\t\\N\n"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+type header struct{ version, flags byte }
+
+func (h *header) MarshalBinary() ([]byte, error) {
+	return []byte{'v', h.version, h.flags}, nil
+}
+
+func TestBinaryMarshaler(t *testing.T) {
+	got, err := mysqltsv.EscapeValue(&header{'1', 0}, nil)
+	if err != nil {
+		t.Fatalf("EscapeValue failed: %v", err)
+	}
+	if want := "\"v1\\0\""; string(got) != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+type color int
+
+func (c color) String() string {
+	return [...]string{"red", "green"}[c]
+}
+
+type version struct{ major, minor int }
+
+func (v *version) String() string {
+	return fmt.Sprintf("v%d.%d", v.major, v.minor)
+}
+
+func TestAllowStringer(t *testing.T) {
+	if _, err := mysqltsv.FormatValue(struct{ fmt.Stringer }{color(1)}, nil); err == nil {
+		t.Errorf("FormatValue accepted a fmt.Stringer without AllowStringer")
+	}
+	d := time.Hour
+	cfg := &mysqltsv.EncoderOptions{AllowStringer: true}
+	for _, tc := range []struct {
+		v    any
+		want string
+	}{
+		{struct{ fmt.Stringer }{color(1)}, "'green'"},
+		{&version{1, 2}, "'v1.2'"},
+		{&d, "'01:00:00'"},
+	} {
+		got, err := mysqltsv.FormatValue(tc.v, cfg)
+		if err != nil {
+			t.Errorf("FormatValue(%v) failed: %v", tc.v, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestJSONFallback(t *testing.T) {
+	cfg := &mysqltsv.EncoderOptions{JSONFallback: true}
+	for _, tc := range []struct {
+		v    any
+		want string
+	}{
+		{map[string]int{"a": 1}, `'{"a":1}'`},
+		{[]string{"x", "y"}, `'["x","y"]'`},
+		{struct{ A int }{2}, `'{"A":2}'`},
+		{[]int(nil), "NULL"},
+	} {
+		got, err := mysqltsv.FormatValue(tc.v, cfg)
+		if err != nil {
+			t.Errorf("FormatValue(%v) failed: %v", tc.v, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+	if _, err := mysqltsv.FormatValue(map[string]int{}, nil); err == nil {
+		t.Errorf("FormatValue accepted a map without JSONFallback")
+	}
+}
+
+type apiResponse struct{ status int }
+
+func (r apiResponse) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`{"status":%d}`, r.status)), nil
+}
+
+func TestJSONMarshaler(t *testing.T) {
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	cfg := &mysqltsv.EncoderOptions{JSONFallback: true}
+	for _, tc := range []struct {
+		v    any
+		want string
+	}{
+		{apiResponse{200}, `'{"status":200}'`},
+		{&apiResponse{404}, `'{"status":404}'`},
+		{&ts, "'2024-01-02 03:04:05'"},
+	} {
+		got, err := mysqltsv.FormatValue(tc.v, cfg)
+		if err != nil {
+			t.Errorf("FormatValue(%v) failed: %v", tc.v, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	for _, tc := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "'00:00:00'"},
+		{90 * time.Second, "'00:01:30'"},
+		{-(100*time.Hour + 2*time.Minute + 3*time.Second + 500*time.Millisecond), "'-100:02:03.5'"},
+		{time.Microsecond, "'00:00:00.000001'"},
+	} {
+		got, err := mysqltsv.FormatValue(tc.d, nil)
+		if err != nil {
+			t.Errorf("FormatValue(%v) failed: %v", tc.d, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", tc.d, got, tc.want)
+		}
+	}
+}
+
+type testUUID [16]byte
+
+func (u testUUID) Value() (driver.Value, error) {
+	return "valuer", nil
+}
+
+func TestUUIDFormat(t *testing.T) {
+	mysqltsv.RegisterUUIDType[testUUID]()
+	u := testUUID{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+	for _, v := range []any{u, [16]byte(u)} {
+		got, err := mysqltsv.FormatValue(v, &mysqltsv.EncoderOptions{UUIDFormat: mysqltsv.UUIDText})
+		if err != nil {
+			t.Fatalf("FormatValue failed: %v", err)
+		}
+		if want := "'123e4567-e89b-12d3-a456-426614174000'"; got != want {
+			t.Errorf("Got %s, want %s", got, want)
+		}
+		got, err = mysqltsv.FormatValue(v, &mysqltsv.EncoderOptions{HexBinary: true})
+		if err != nil {
+			t.Fatalf("FormatValue failed: %v", err)
+		}
+		if want := "'123e4567e89b12d3a456426614174000'"; got != want {
+			t.Errorf("Got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestIPAddresses(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.0.0.0/8")
+	for _, tc := range []struct {
+		v      any
+		packed bool
+		want   string
+	}{
+		{net.ParseIP("192.0.2.1"), false, "'192.0.2.1'"},
+		{net.ParseIP("192.0.2.1"), true, "'c0000201'"},
+		{netip.MustParseAddr("2001:db8::1"), false, "'2001:db8::1'"},
+		{netip.MustParseAddr("::ffff:192.0.2.1"), true, "'c0000201'"},
+		{netip.MustParsePrefix("192.0.2.0/24"), true, "'192.0.2.0/24'"},
+		{network, false, "'10.0.0.0/8'"},
+		{net.IP(nil), false, "NULL"},
+		{net.IP{}, false, "NULL"},
+		{net.IP{}, true, "NULL"},
+		{netip.Addr{}, false, "NULL"},
+	} {
+		got, err := mysqltsv.FormatValue(tc.v, &mysqltsv.EncoderOptions{PackedIP: tc.packed, HexBinary: true})
+		if err != nil {
+			t.Errorf("FormatValue(%v) failed: %v", tc.v, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestInvalidIPLength(t *testing.T) {
+	for _, packed := range []bool{false, true} {
+		if got, err := mysqltsv.FormatValue(net.IP{1, 2, 3}, &mysqltsv.EncoderOptions{PackedIP: packed}); err == nil {
+			t.Errorf("FormatValue accepted a 3 byte net.IP with PackedIP %v: %s", packed, got)
+		}
+	}
+}
+
+func TestNonFinite(t *testing.T) {
+	if _, err := mysqltsv.FormatValue(math.NaN(), nil); err == nil {
+		t.Errorf("FormatValue accepted NaN")
+	}
+	for _, tc := range []struct {
+		v      any
+		policy mysqltsv.NonFinitePolicy
+		want   string
+	}{
+		{math.Inf(1), mysqltsv.NonFiniteNull, "NULL"},
+		{math.NaN(), mysqltsv.NonFiniteClamp, "NULL"},
+		{float32(math.Inf(-1)), mysqltsv.NonFiniteClamp, "'-340282346638528860000000000000000000000'"},
+	} {
+		got, err := mysqltsv.FormatValue(tc.v, &mysqltsv.EncoderOptions{NonFinite: tc.policy})
+		if err != nil {
+			t.Errorf("FormatValue(%v) failed: %v", tc.v, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestBoolFormat(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, &mysqltsv.EncoderOptions{BoolFormat: &mysqltsv.BoolFormat{True: "TRUE", False: "FALSE"}})
+	e.AppendValue(true)
+	e.AppendValue(false)
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, want := buf.String(), "\"TRUE\"\t\"FALSE\"\n"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+}
+
+type failingWriter struct {
+	err error
+}
+
+func (f failingWriter) Write(p []byte) (int, error) {
+	return 0, f.err
+}
+
+func TestShardedEncoder(t *testing.T) {
+	bufs := make([]*bytes.Buffer, 3)
+	writers := make([]io.Writer, len(bufs))
+	for i := range bufs {
+		bufs[i] = new(bytes.Buffer)
+		writers[i] = bufs[i]
+	}
+	e := mysqltsv.NewShardedEncoder(writers, 2, 0, nil)
+	for i := 0; 10 > i; i++ {
+		e.AppendRow([]any{fmt.Sprintf("key%d", i), i})
+		e.AppendRow([]any{fmt.Sprintf("key%d", i), i})
+	}
+	e.AppendRow([]any{nil, "null"})
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	for i := 0; 10 > i; i++ {
+		line := fmt.Sprintf("\"key%d\"\t\"%d\"\n", i, i)
+		found := 0
+		for _, buf := range bufs {
+			if n := strings.Count(buf.String(), line); n != 0 && n != 2 {
+				t.Errorf("key%d is split over shards", i)
+			} else if n == 2 {
+				found++
+			}
+		}
+		if found != 1 {
+			t.Errorf("key%d was found in %d shards, want 1", i, found)
+		}
+	}
+	if !strings.Contains(bufs[0].String(), "\\N\t\"null\"\n") {
+		t.Errorf("NULL key didn't go to shard 0: %q", bufs[0].String())
+	}
+}
+
+func TestShardedEncoderNullIfZero(t *testing.T) {
+	bufs := make([]*bytes.Buffer, 3)
+	writers := make([]io.Writer, len(bufs))
+	for i := range bufs {
+		bufs[i] = new(bytes.Buffer)
+		writers[i] = bufs[i]
+	}
+	e := mysqltsv.NewShardedEncoder(writers, 1, 0, &mysqltsv.EncoderOptions{Columns: []mysqltsv.ColumnOptions{{NullIfZero: true}}})
+	for _, v := range []any{0, "", nil} {
+		e.AppendRow([]any{v})
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, want := bufs[0].String(), "\\N\n\\N\n\\N\n"; got != want {
+		t.Errorf("Shard 0 = %q, want all NULL keys %q", got, want)
+	}
+}
+
+func TestShardedEncoderErrors(t *testing.T) {
+	e := mysqltsv.NewShardedEncoder([]io.Writer{io.Discard}, 2, 0, nil)
+	e.AppendRow([]any{1})
+	if e.Error() == nil {
+		t.Errorf("AppendRow accepted a row with too few columns")
+	}
+
+	writeErr := fmt.Errorf("disk full")
+	e = mysqltsv.NewShardedEncoder([]io.Writer{failingWriter{writeErr}, io.Discard}, 1, 0, nil)
+	e.AppendRow([]any{nil})
+	if err := e.Close(); err != writeErr {
+		t.Errorf("Close returned %v, want %v", err, writeErr)
+	}
+}
+
+type recordingWriteCloser struct {
+	bytes.Buffer
+	closed   bool
+	closeErr error
+}
+
+func (r *recordingWriteCloser) Close() error {
+	r.closed = true
+	return r.closeErr
+}
+
+func TestPartitionedEncoder(t *testing.T) {
+	outputs := map[string]*recordingWriteCloser{}
+	var nullOutput *recordingWriteCloser
+	closeErr := fmt.Errorf("upload failed")
+	open := func(key string, null bool) (io.WriteCloser, error) {
+		w := &recordingWriteCloser{}
+		if null {
+			if nullOutput != nil {
+				t.Errorf("NULL partition opened twice")
+			}
+			nullOutput = w
+			return w, nil
+		}
+		if _, ok := outputs[key]; ok {
+			t.Errorf("Partition %q opened twice", key)
+		}
+		if key == "b" {
+			w.closeErr = closeErr
+		}
+		outputs[key] = w
+		return w, nil
+	}
+	e := mysqltsv.NewPartitionedEncoder(2, 1, open, nil)
+	if len(outputs) != 0 {
+		t.Errorf("Partitions were opened before any rows were appended")
+	}
+	e.AppendRow([]any{1, "b"})
+	e.AppendRow([]any{2, "a"})
+	e.AppendRow([]any{3, "b"})
+	e.AppendRow([]any{4, nil})
+	if got, want := e.Keys(), []string{"a", "b"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+	if err := e.Close(); err != closeErr {
+		t.Errorf("Close returned %v, want %v", err, closeErr)
+	}
+	want := map[string]string{
+		"a": "\"2\"\t\"a\"\n",
+		"b": "\"1\"\t\"b\"\n\"3\"\t\"b\"\n",
+	}
+	for key, w := range outputs {
+		if w.String() != want[key] {
+			t.Errorf("Partition %q = %q, want %q", key, w.String(), want[key])
+		}
+		if !w.closed {
+			t.Errorf("Partition %q wasn't closed", key)
+		}
+	}
+	if nullOutput == nil || nullOutput.String() != "\"4\"\t\\N\n" || !nullOutput.closed {
+		t.Errorf("Unexpected NULL partition: %+v", nullOutput)
+	}
+}
+
+func TestPartitionedEncoderColumnOptions(t *testing.T) {
+	amsterdam, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skipf("No timezone database: %v", err)
+	}
+	var keys []string
+	var nulls int
+	open := func(key string, null bool) (io.WriteCloser, error) {
+		if null {
+			nulls++
+		} else {
+			keys = append(keys, key)
+		}
+		return &recordingWriteCloser{}, nil
+	}
+	cfg := &mysqltsv.EncoderOptions{Columns: []mysqltsv.ColumnOptions{{Location: amsterdam}, {NullIfZero: true}}}
+	e := mysqltsv.NewPartitionedEncoder(2, 0, open, cfg)
+	e.AppendRow([]any{time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC), 1})
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if want := []string{"2024-01-02"}; fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("Opened partitions %v, want %v", keys, want)
+	}
+
+	keys = nil
+	e = mysqltsv.NewPartitionedEncoder(2, 1, open, cfg)
+	e.AppendRow([]any{time.Now(), 0})
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if len(keys) != 0 || nulls != 1 {
+		t.Errorf("Zero key with NullIfZero opened partitions %v and %d NULL partitions, want only the NULL partition", keys, nulls)
+	}
+}
+
+type recordingSink struct {
+	outputs   map[string]*recordingWriteCloser
+	completed []mysqltsv.ChunkInfo
+}
+
+func (s *recordingSink) Open(name string) (io.WriteCloser, error) {
+	w := &recordingWriteCloser{}
+	s.outputs[name] = w
+	return w, nil
+}
+
+func (s *recordingSink) Complete(info mysqltsv.ChunkInfo) error {
+	if !s.outputs[info.Name].closed {
+		return fmt.Errorf("chunk %s completed before it was closed", info.Name)
+	}
+	s.completed = append(s.completed, info)
+	return nil
+}
+
+func TestChunkSinkEncoder(t *testing.T) {
+	sink := &recordingSink{outputs: map[string]*recordingWriteCloser{}}
+	name := func(n int) string {
+		return fmt.Sprintf("part-%d.tsv", n)
+	}
+	e := mysqltsv.NewChunkSinkEncoder(1, sink, name, mysqltsv.RotateOptions{MaxRows: 2}, &mysqltsv.EncoderOptions{Checksums: true})
+	for i := 0; 5 > i; i++ {
+		e.AppendValue(i)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if len(sink.completed) != 3 {
+		t.Fatalf("Got %d completed chunks, want 3", len(sink.completed))
+	}
+	for i, info := range sink.completed {
+		data := sink.outputs[name(i)].Bytes()
+		wantRows := int64(2)
+		if i == 2 {
+			wantRows = 1
+		}
+		if info.Name != name(i) || info.Index != i || info.Rows != wantRows || info.Bytes != int64(len(data)) {
+			t.Errorf("Chunk %d: unexpected info %+v", i, info)
+		}
+		sum := sha256.Sum256(data)
+		if info.Checksums == nil || info.Checksums.SHA256 != hex.EncodeToString(sum[:]) || info.Checksums.Rows != wantRows {
+			t.Errorf("Chunk %d: unexpected checksums %+v", i, info.Checksums)
+		}
+	}
+}
+
+func TestTee(t *testing.T) {
+	var buf, tee bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 1, &mysqltsv.EncoderOptions{Tee: &tee, Compressor: mysqltsv.Gzip})
+	e.AppendString("hello")
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, want := tee.String(), "\"hello\"\n"; got != want {
+		t.Errorf("Tee got %q, want the uncompressed %q", got, want)
+	}
+
+	teeErr := fmt.Errorf("audit log unavailable")
+	e = mysqltsv.NewEncoder(io.Discard, 1, &mysqltsv.EncoderOptions{Tee: failingWriter{teeErr}})
+	e.AppendString("hello")
+	if err := e.Close(); err != teeErr {
+		t.Errorf("Close returned %v, want %v", err, teeErr)
+	}
+}
+
+func TestXMLEncoderControlCharacters(t *testing.T) {
+	for _, s := range []string{"a\tb", "a\nb", "a\rb", "a\x00b"} {
+		e := mysqltsv.NewXMLEncoder(io.Discard, []string{"name"}, nil)
+		e.AppendString(s)
+		if err := e.Close(); err == nil {
+			t.Errorf("XMLEncoder accepted %q", s)
+		}
+	}
+}
+
+func TestXMLEncoderWithoutColumns(t *testing.T) {
+	e := mysqltsv.NewXMLEncoder(io.Discard, nil, nil)
+	e.AppendString("x")
+	if err := e.Close(); err == nil {
+		t.Errorf("XMLEncoder without columns succeeded")
+	}
+}
+
+func TestGeneratedColumnsWithCompleteRows(t *testing.T) {
+	cfg := &mysqltsv.EncoderOptions{Columns: []mysqltsv.ColumnOptions{{}, {Generate: func() any { return 1 }}}}
+	s := mysqltsv.NewShardedEncoder([]io.Writer{io.Discard}, 2, 0, cfg)
+	s.AppendRow([]any{"k", "v"})
+	if err := s.Close(); err == nil {
+		t.Errorf("ShardedEncoder accepted generated columns")
+	}
+	p := mysqltsv.NewPartitionedEncoder(2, 0, func(string, bool) (io.WriteCloser, error) { return nopWriteCloser{new(bytes.Buffer)}, nil }, cfg)
+	p.AppendRow([]any{"k", "v"})
+	if err := p.Close(); err == nil {
+		t.Errorf("PartitionedEncoder accepted generated columns")
+	}
+	e := mysqltsv.NewEncoder(io.Discard, 2, cfg)
+	if _, err := mysqltsv.CopyFrom(e, mysqltsv.CopyFromRows([][]any{{"k", "v"}})); err == nil {
+		t.Errorf("CopyFrom accepted generated columns")
+	}
+	if _, err := mysqltsv.EstimateSize([][]any{{"k", "v"}}, cfg); err == nil {
+		t.Errorf("EstimateSize accepted generated columns")
+	}
+}
+
+// failingCopyFromSource yields its rows and then fails with err.
+type failingCopyFromSource struct {
+	mysqltsv.CopyFromSource
+	err error
+}
+
+func (s failingCopyFromSource) Err() error {
+	return s.err
+}
+
+func TestCopyFrom(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, nil)
+	n, err := mysqltsv.CopyFrom(e, mysqltsv.CopyFromRows([][]any{{1, "a"}, {2, nil}}))
+	if err != nil {
+		t.Fatalf("CopyFrom failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("CopyFrom encoded %d rows, want 2", n)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if want := "\"1\"\t\"a\"\n\"2\"\t\\N\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+
+	srcErr := fmt.Errorf("connection reset")
+	e = mysqltsv.NewEncoder(io.Discard, 1, nil)
+	n, err = mysqltsv.CopyFrom(e, failingCopyFromSource{mysqltsv.CopyFromRows([][]any{{1}}), srcErr})
+	if err != srcErr {
+		t.Errorf("CopyFrom returned %v, want %v", err, srcErr)
+	}
+	if n != 1 {
+		t.Errorf("CopyFrom encoded %d rows before the error, want 1", n)
+	}
+}
+
+// sliceRowReader returns its rows, and then err or io.EOF. It reuses the slice it returns, like RowReader allows.
+type sliceRowReader struct {
+	rows [][]any
+	err  error
+	row  []any
+}
+
+func (r *sliceRowReader) ReadRow() ([]any, error) {
+	if len(r.rows) == 0 {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, io.EOF
+	}
+	r.row = append(r.row[:0], r.rows[0]...)
+	r.rows = r.rows[1:]
+	return r.row, nil
+}
+
+func TestFromRowReader(t *testing.T) {
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 2, nil)
+	n, err := mysqltsv.FromRowReader(&sliceRowReader{rows: [][]any{{1, "a"}, {2, nil}}}, e)
+	if err != nil {
+		t.Fatalf("FromRowReader failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("FromRowReader encoded %d rows, want 2", n)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if want := "\"1\"\t\"a\"\n\"2\"\t\\N\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+
+	readErr := fmt.Errorf("corrupt page")
+	buf.Reset()
+	e = mysqltsv.NewEncoder(&buf, 1, nil)
+	n, err = mysqltsv.FromRowReader(&sliceRowReader{rows: [][]any{{1}, {2}}, err: readErr}, e)
+	if err != readErr {
+		t.Errorf("FromRowReader returned %v, want %v", err, readErr)
+	}
+	if n != 2 {
+		t.Errorf("FromRowReader encoded %d rows before the error, want 2", n)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if want := "\"1\"\n\"2\"\n"; buf.String() != want {
+		t.Errorf("Got %q, want %q", buf.String(), want)
+	}
+
+	e = mysqltsv.NewEncoder(io.Discard, 2, nil)
+	if _, err := mysqltsv.FromRowReader(&sliceRowReader{rows: [][]any{{1}}}, e); err == nil {
+		t.Errorf("FromRowReader accepted a row with too few columns")
+	}
+}
@@ -107,3 +107,102 @@ func TestRoundtrip(t *testing.T) {
 		t.Errorf("rows.Close: %v", err)
 	}
 }
+
+func TestRoundtripColumnSubset(t *testing.T) {
+	ctx := context.Background()
+	dsn := os.Getenv("TEST_DSN")
+	if dsn == "" {
+		t.Fatalf("Environment variable TEST_DSN is empty")
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	// information_schema doesn't list temporary tables.
+	if _, err := db.ExecContext(ctx, "CREATE TABLE column_subset_test (id INT NOT NULL PRIMARY KEY, name VARCHAR(255) NOT NULL, note TEXT NULL, created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, required INT NOT NULL)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	defer db.ExecContext(ctx, "DROP TABLE column_subset_test")
+
+	if err := mysqltsv.CheckOmittedColumns(ctx, db, "column_subset_test", []string{"id", "name"}); err == nil {
+		t.Errorf("CheckOmittedColumns accepted omitting a NOT NULL column without a default")
+	}
+	if err := mysqltsv.CheckOmittedColumns(ctx, db, "column_subset_test", []string{"id", "name", "required", "missing"}); err == nil {
+		t.Errorf("CheckOmittedColumns accepted a column that doesn't exist")
+	}
+	opts := mysqltsv.DefaultOptions()
+	opts.Columns = []string{"id", "name", "required"}
+	if err := mysqltsv.CheckOmittedColumns(ctx, db, "column_subset_test", opts.Columns); err != nil {
+		t.Fatalf("CheckOmittedColumns failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	e := mysqltsv.NewEncoder(&buf, 3, &mysqltsv.EncoderOptions{Dialect: &opts})
+	e.AppendValue(1)
+	e.AppendValue("alice")
+	e.AppendValue(7)
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	mysql.RegisterReaderHandler("subset", func() io.Reader { return &buf })
+	if _, err := db.ExecContext(ctx, "LOAD DATA LOCAL INFILE 'Reader::subset' INTO TABLE `column_subset_test` "+opts.Clause()); err != nil {
+		t.Fatalf("LOAD DATA LOCAL INFILE failed: %v", err)
+	}
+	var name string
+	var note sql.NullString
+	var required int
+	if err := db.QueryRowContext(ctx, "SELECT name, note, required FROM column_subset_test WHERE id = 1").Scan(&name, &note, &required); err != nil {
+		t.Fatalf("Failed to read row: %v", err)
+	}
+	if name != "alice" || note.Valid || required != 7 {
+		t.Errorf("Got %q, %v, %d, want \"alice\", NULL, 7", name, note, required)
+	}
+}
+
+func TestRoundtripXML(t *testing.T) {
+	ctx := context.Background()
+	dsn := os.Getenv("TEST_DSN")
+	if dsn == "" {
+		t.Fatalf("Environment variable TEST_DSN is empty")
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatalf("Failed to connect to database: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(ctx, "CREATE TEMPORARY TABLE xml_roundtrip_test (id INT NOT NULL PRIMARY KEY, data TEXT NULL)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	values := []any{`<a & "b">`, "it's", "ünïcödé", "", nil}
+	var buf bytes.Buffer
+	e := mysqltsv.NewXMLEncoder(&buf, []string{"id", "data"}, nil)
+	for i, v := range values {
+		e.AppendValue(i)
+		e.AppendValue(v)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Encoding failed: %v", err)
+	}
+	mysql.RegisterReaderHandler("xml", func() io.Reader { return &buf })
+	if _, err := db.ExecContext(ctx, "LOAD XML LOCAL INFILE 'Reader::xml' INTO TABLE `xml_roundtrip_test` CHARACTER SET utf8mb4 ROWS IDENTIFIED BY '<row>'"); err != nil {
+		t.Fatalf("LOAD XML LOCAL INFILE failed: %v", err)
+	}
+
+	for i, v := range values {
+		var got sql.NullString
+		if err := db.QueryRowContext(ctx, "SELECT data FROM xml_roundtrip_test WHERE id = ?", i).Scan(&got); err != nil {
+			t.Fatalf("Failed to read row %d: %v", i, err)
+		}
+		if v == nil {
+			if got.Valid {
+				t.Errorf("Row %d: got %q, want NULL", i, got.String)
+			}
+		} else if !got.Valid || got.String != v {
+			t.Errorf("Row %d: got %v, want %q", i, got, v)
+		}
+	}
+}
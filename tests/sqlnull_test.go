@@ -0,0 +1,50 @@
+//go:build go1.22
+
+package mysqltsv_test
+
+import (
+	"database/sql"
+	"math/big"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/hexon/mysqltsv"
+)
+
+func TestSQLNullGeneric(t *testing.T) {
+	cfg := &mysqltsv.EncoderOptions{UUIDFormat: mysqltsv.UUIDText}
+	for _, tc := range []struct {
+		v    any
+		want string
+	}{
+		{sql.Null[time.Duration]{V: time.Hour, Valid: true}, "'01:00:00'"},
+		{&sql.Null[time.Duration]{V: time.Hour, Valid: true}, "'01:00:00'"},
+		{sql.Null[[16]byte]{V: [16]byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}, Valid: true}, "'123e4567-e89b-12d3-a456-426614174000'"},
+		{sql.Null[netip.Addr]{V: netip.MustParseAddr("2001:db8::1"), Valid: true}, "'2001:db8::1'"},
+		{sql.Null[*big.Int]{V: big.NewInt(42), Valid: true}, "'42'"},
+		{sql.Null[string]{V: "ignored"}, "NULL"},
+	} {
+		got, err := mysqltsv.FormatValue(tc.v, cfg)
+		if err != nil {
+			t.Errorf("FormatValue(%v) failed: %v", tc.v, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("FormatValue(%v) = %s, want %s", tc.v, got, tc.want)
+		}
+	}
+}
+
+func TestCreateTableStatementSQLNullGeneric(t *testing.T) {
+	type row struct {
+		Name sql.Null[string]
+	}
+	got, err := mysqltsv.CreateTableStatement[row]("staging")
+	if err != nil {
+		t.Fatalf("CreateTableStatement failed: %v", err)
+	}
+	if want := "CREATE TABLE `staging` (\n\t`name` VARCHAR(255) NULL\n)"; got != want {
+		t.Errorf("Got %s, want %s", got, want)
+	}
+}
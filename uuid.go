@@ -0,0 +1,66 @@
+package mysqltsv
+
+import (
+	"encoding/hex"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// UUIDFormat is how UUIDs are encoded. See EncoderOptions.UUIDFormat.
+type UUIDFormat int
+
+const (
+	// UUIDBinary encodes UUIDs as their 16 raw bytes, for BINARY(16) columns.
+	UUIDBinary UUIDFormat = iota
+	// UUIDText encodes UUIDs in their canonical text form, like 123e4567-e89b-12d3-a456-426614174000, for CHAR(36) columns.
+	UUIDText
+)
+
+var (
+	registeredUUIDTypes    sync.Map // map[reflect.Type]func(v any) [16]byte
+	hasRegisteredUUIDTypes atomic.Bool
+)
+
+// RegisterUUIDType registers a UUID type, like uuid.UUID from github.com/google/uuid, so it's encoded according to EncoderOptions.UUIDFormat instead of with its Value method.
+// It should be called during initialization, as it affects all encoders.
+func RegisterUUIDType[T ~[16]byte]() {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	registeredUUIDTypes.Store(t, func(v any) [16]byte {
+		return [16]byte(v.(T))
+	})
+	hasRegisteredUUIDTypes.Store(true)
+}
+
+// uuidBytes returns the bytes of v if it's a [16]byte or a registered UUID type.
+func uuidBytes(v any) ([16]byte, bool) {
+	if u, ok := v.([16]byte); ok {
+		return u, true
+	}
+	if !hasRegisteredUUIDTypes.Load() {
+		return [16]byte{}, false
+	}
+	fn, ok := registeredUUIDTypes.Load(reflect.TypeOf(v))
+	if !ok {
+		return [16]byte{}, false
+	}
+	return fn.(func(v any) [16]byte)(v), true
+}
+
+// appendUUID appends u in the UUIDFormat of cfg.
+func appendUUID(dst []byte, u [16]byte, cfg *EncoderOptions) ([]byte, error) {
+	if cfg == nil || cfg.UUIDFormat != UUIDText {
+		return appendValue(dst, u[:], cfg)
+	}
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return append(dst, buf[:]...), nil
+}
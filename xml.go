@@ -0,0 +1,133 @@
+package mysqltsv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// XMLEncoder encodes values into an XML file suitable for consumption by LOAD XML INFILE, for environments where LOAD DATA isn't allowed.
+// Each row is written as <row><field name="...">...</field></row>, so load it with:
+//
+//	LOAD XML LOCAL INFILE '...' INTO TABLE t ROWS IDENTIFIED BY '<row>'
+//
+// Values are formatted the same way as by the Encoder. Binary data that isn't valid UTF-8 can't be represented in XML and results in an error.
+// So do control characters, including tabs and line breaks: LOAD XML only decodes the named entities like &amp;, not character references like &#10;, and would load those literally.
+// Any errors during appending will be stored and future calls will be ignored.
+// The encoder must be Close()d once done to finish the document, flush and to read any errors that might have occurred.
+type XMLEncoder struct {
+	w              *bufio.Writer
+	columns        []string
+	col            int
+	err            error
+	encoderOptions *EncoderOptions
+	scratch        []byte
+}
+
+// NewXMLEncoder starts a new XML encoder. Each row has one field for each of the given column names.
+// Close must be called to see if any error occurred.
+// EncoderOptions is optional. Only the options that affect the formatting of values are used.
+func NewXMLEncoder(w io.Writer, columns []string, cfg *EncoderOptions) *XMLEncoder {
+	e := &XMLEncoder{
+		w:              bufio.NewWriterSize(w, 16*1024),
+		columns:        columns,
+		encoderOptions: cfg,
+		scratch:        make([]byte, 0, 64),
+	}
+	if len(columns) == 0 {
+		e.err = fmt.Errorf("XMLEncoder needs at least one column")
+		return e
+	}
+	_, e.err = e.w.WriteString("<?xml version=\"1.0\"?>\n<resultset xmlns:xsi=\"http://www.w3.org/2001/XMLSchema-instance\">\n")
+	return e
+}
+
+func (e *XMLEncoder) writeField(b []byte) {
+	buf := e.w.AvailableBuffer()
+	if e.col == 0 {
+		buf = append(buf, "<row>\n"...)
+	}
+	buf = append(buf, "\t<field name=\""...)
+	buf, _ = appendXMLEscaped(buf, []byte(e.columns[e.col]))
+	if b == nil {
+		buf = append(buf, "\" xsi:nil=\"true\" />\n"...)
+	} else {
+		buf = append(buf, "\">"...)
+		var err error
+		buf, err = appendXMLEscaped(buf, b)
+		if err != nil {
+			e.err = fmt.Errorf("column %q: %w", e.columns[e.col], err)
+			return
+		}
+		buf = append(buf, "</field>\n"...)
+	}
+	e.col++
+	if e.col == len(e.columns) {
+		buf = append(buf, "</row>\n"...)
+		e.col = 0
+	}
+	_, e.err = e.w.Write(buf)
+}
+
+// appendXMLEscaped appends data escaped for use in XML text and attribute values.
+func appendXMLEscaped(appendTo, data []byte) ([]byte, error) {
+	if !utf8.Valid(data) {
+		return appendTo, fmt.Errorf("can't represent invalid UTF-8 in XML")
+	}
+	for _, c := range data {
+		switch c {
+		case '&':
+			appendTo = append(appendTo, "&amp;"...)
+		case '<':
+			appendTo = append(appendTo, "&lt;"...)
+		case '>':
+			appendTo = append(appendTo, "&gt;"...)
+		case '"':
+			appendTo = append(appendTo, "&quot;"...)
+		default:
+			if c < 0x20 {
+				return appendTo, fmt.Errorf("can't represent control character %#x in XML", c)
+			}
+			appendTo = append(appendTo, c)
+		}
+	}
+	return appendTo, nil
+}
+
+func (e *XMLEncoder) AppendString(s string) {
+	e.AppendValue(s)
+}
+
+func (e *XMLEncoder) AppendBytes(b []byte) {
+	if e.err != nil {
+		return
+	}
+	e.writeField(b)
+}
+
+func (e *XMLEncoder) AppendValue(v any) {
+	if e.err != nil {
+		return
+	}
+	b, err := appendValue(e.scratch[:0], v, e.encoderOptions)
+	if err != nil {
+		e.err = err
+		return
+	}
+	e.writeField(b)
+}
+
+func (e *XMLEncoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	if _, err := e.w.WriteString("</resultset>\n"); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+func (e *XMLEncoder) Error() error {
+	return e.err
+}